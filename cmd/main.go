@@ -2,17 +2,37 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
-	"slices"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/fabiant7t/exips/internal/api"
 	"github.com/fabiant7t/exips/internal/config"
+	"github.com/fabiant7t/exips/internal/dns"
+	"github.com/fabiant7t/exips/internal/externalipset"
+	"github.com/fabiant7t/exips/internal/gateway"
+	"github.com/fabiant7t/exips/internal/health"
+	"github.com/fabiant7t/exips/internal/ingress"
+	"github.com/fabiant7t/exips/internal/leader"
+	"github.com/fabiant7t/exips/internal/metrics"
+	"github.com/fabiant7t/exips/internal/node"
 	"github.com/fabiant7t/exips/internal/node/registry"
-	"github.com/fabiant7t/exips/internal/service"
+	"github.com/fabiant7t/exips/internal/reconciler"
+	"github.com/fabiant7t/exips/internal/server"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 var (
@@ -42,10 +62,64 @@ func main() {
 		"service_name", cfg.ServiceName,
 		"service_namespace", cfg.ServiceNamespace,
 		"kube_config", cfg.KubeConfig,
+		"ip_family_policy", cfg.IPFamilyPolicy,
+		"ports", cfg.Ports,
+		"service_type", cfg.ServiceType,
+		"endpoints", cfg.Endpoints,
+		"allowed_cidrs", cfg.AddressFilter.Allowed,
+		"denied_cidrs", cfg.AddressFilter.Denied,
+		"address_types", cfg.AddressTypes,
+		"resolve_addresses", cfg.ResolveAddresses,
+		"static_ips", cfg.StaticIPs,
+		"dns_server", cfg.DNS.Server,
+		"dns_zone", cfg.DNS.Zone,
+		"dns_responder_zone", cfg.DNSResponder.Zone,
+		"dns_responder_addr", cfg.DNSResponderAddr,
+		"external_ip_sets", cfg.ExternalIPSets,
+		"external_ip_set_namespaces", cfg.ExternalIPSetNamespaces,
+		"external_ip_set_ports", cfg.ExternalIPSetPorts,
+		"ingress_class", cfg.IngressClass,
+		"gateway_class", cfg.GatewayClass,
+		"gateway_spec_addresses", cfg.GatewaySpecAddresses,
+		"require_ready", cfg.RequireReady,
+		"exclude_cordoned", cfg.ExcludeCordoned,
+		"exclude_taints", cfg.ExcludeTaints,
+		"exclude_conditions", cfg.ExcludeConditions,
+		"node_selector", cfg.NodeSelector.String(),
+		"node_field_selector", cfg.NodeFieldSelector.String(),
+		"ingress_pod_namespace", cfg.IngressPodNamespace,
+		"ingress_pod_selector", cfg.IngressPodSelector,
+		"leader_elect", cfg.LeaderElect,
+		"leader_election_namespace", cfg.LeaderElection.Namespace,
+		"leader_election_name", cfg.LeaderElection.Name,
+		"leader_election_identity", cfg.LeaderElection.Identity,
+		"leader_election_lease_duration", cfg.LeaderElection.LeaseDuration,
+		"leader_election_renew_deadline", cfg.LeaderElection.RenewDeadline,
+		"leader_election_retry_period", cfg.LeaderElection.RetryPeriod,
+		"debounce", cfg.Debounce,
 		"interval", cfg.Interval,
 		"resync", cfg.Resync,
+		"retry_base_delay", cfg.RetryBaseDelay,
+		"retry_max_delay", cfg.RetryMaxDelay,
+		"max_retries", cfg.MaxRetries,
+		"http_addr", cfg.HTTPAddr,
+		"probe_intervals", cfg.ProbeIntervals,
 		"debug", cfg.Debug,
 	)
+	for _, t := range cfg.Targets {
+		slog.Info("Target",
+			"service_name", t.ServiceName,
+			"service_namespace", t.ServiceNamespace,
+			"node_selector", t.NodeSelector.String(),
+			"ip_family_policy", t.IPFamilyPolicy,
+			"address_types", t.AddressTypes,
+			"static_ips", t.StaticIPs,
+			"ports", t.Ports,
+			"service_type", t.ServiceType,
+			"endpoints", t.Endpoints,
+			"dns_name", t.DNSName,
+		)
+	}
 
 	client, err := cfg.Client()
 	if err != nil {
@@ -55,56 +129,189 @@ func main() {
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
+	ctx, fail := context.WithCancelCause(ctx) // a failure stops the process
+	defer fail(nil)
 
-	reg := registry.New()
+	broadcaster := record.NewBroadcaster(record.WithContext(ctx))
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	defer broadcaster.Shutdown()
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "exips"})
+
+	registryOpts := []registry.Option{
+		registry.WithNodeSelector(cfg.NodeSelector, cfg.NodeFieldSelector),
+		registry.WithAddressFilter(cfg.AddressFilter),
+		registry.WithAddressTypes(cfg.AddressTypes),
+		registry.WithEventRecorder(recorder),
+		registry.WithStaticIPs(cfg.StaticIPs),
+	}
+	if cfg.ResolveAddresses {
+		registryOpts = append(registryOpts, registry.WithResolver(net.DefaultResolver))
+	}
+	if cfg.IngressPodSelector != nil {
+		registryOpts = append(registryOpts, registry.WithPodSelector(cfg.IngressPodNamespace, cfg.IngressPodSelector))
+	}
+	reg := registry.New(registryOpts...)
+	eligibility := cfg.Eligibility()
+	if cfg.IngressPodSelector != nil {
+		eligibility = node.All(eligibility, reg.RequireIngressPod())
+	}
+
+	dnsProvider := dns.NewRFC2136(cfg.DNS)
+	targets := make([]reconciler.Target, len(cfg.Targets))
+	for i, t := range cfg.Targets {
+		targets[i] = reconciler.Target{
+			Name:         t.ServiceName,
+			Namespace:    t.ServiceNamespace,
+			Eligibility:  t.Eligibility(eligibility),
+			FamilyPolicy: t.IPFamilyPolicy,
+			AddressTypes: t.AddressTypes,
+			StaticIPs:    t.StaticIPs,
+			Ports:        t.Ports,
+			Type:         t.ServiceType,
+			Endpoints:    t.Endpoints,
+		}
+		if t.DNSName != "" {
+			targets[i].Sinks = append(targets[i].Sinks, dns.NewSink(dnsProvider, t.DNSName))
+		}
+	}
+	rec, err := reconciler.New(client, reg, reconciler.Config{
+		Targets:        targets,
+		Debounce:       cfg.Debounce,
+		Interval:       cfg.Interval,
+		RetryBaseDelay: cfg.RetryBaseDelay,
+		RetryMaxDelay:  cfg.RetryMaxDelay,
+		MaxRetries:     cfg.MaxRetries,
+	})
+	if err != nil {
+		slog.Error("error in configuration", "err", err)
+		os.Exit(1)
+	}
+	// controllers only run on the leader
+	controllers := []func(context.Context) error{rec.Run, reg.ReportAnnotations}
+	var dynamicClient dynamic.Interface
+	if cfg.ExternalIPSets || cfg.GatewayClass != "" {
+		dynamicClient, err = cfg.DynamicClient()
+		if err != nil {
+			slog.Error("error creating kubernetes dynamic client", "err", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.ExternalIPSets {
+		ctrl := externalipset.New(client, dynamicClient, reg, externalipset.Config{
+			Eligibility:    eligibility,
+			Targets:        targets,
+			Namespaces:     cfg.ExternalIPSetNamespaces,
+			Ports:          cfg.ExternalIPSetPorts,
+			StaticIPs:      cfg.StaticIPs,
+			Debounce:       cfg.Debounce,
+			Interval:       cfg.Interval,
+			RetryBaseDelay: cfg.RetryBaseDelay,
+			RetryMaxDelay:  cfg.RetryMaxDelay,
+			MaxRetries:     cfg.MaxRetries,
+		})
+		controllers = append(controllers, func(ctx context.Context) error {
+			if err := ctrl.Run(ctx); err != nil {
+				return fmt.Errorf("error running ExternalIPSet controller: %w", err)
+			}
+			return nil
+		})
+	}
+	if cfg.IngressClass != "" {
+		ctrl := ingress.New(client, reg, ingress.Config{
+			ClassName:      cfg.IngressClass,
+			Eligibility:    eligibility,
+			FamilyPolicy:   cfg.IPFamilyPolicy,
+			Debounce:       cfg.Debounce,
+			Interval:       cfg.Interval,
+			RetryBaseDelay: cfg.RetryBaseDelay,
+			RetryMaxDelay:  cfg.RetryMaxDelay,
+			MaxRetries:     cfg.MaxRetries,
+		})
+		controllers = append(controllers, func(ctx context.Context) error {
+			if err := ctrl.Run(ctx); err != nil {
+				return fmt.Errorf("error running Ingress controller: %w", err)
+			}
+			return nil
+		})
+	}
+	if cfg.GatewayClass != "" {
+		ctrl := gateway.New(dynamicClient, reg, gateway.Config{
+			ClassName:      cfg.GatewayClass,
+			SpecAddresses:  cfg.GatewaySpecAddresses,
+			Eligibility:    eligibility,
+			FamilyPolicy:   cfg.IPFamilyPolicy,
+			Debounce:       cfg.Debounce,
+			Interval:       cfg.Interval,
+			RetryBaseDelay: cfg.RetryBaseDelay,
+			RetryMaxDelay:  cfg.RetryMaxDelay,
+			MaxRetries:     cfg.MaxRetries,
+		})
+		controllers = append(controllers, func(ctx context.Context) error {
+			if err := ctrl.Run(ctx); err != nil {
+				return fmt.Errorf("error running Gateway controller: %w", err)
+			}
+			return nil
+		})
+	}
 
 	var wg sync.WaitGroup
 	wg.Go(func() {
-		if err := reg.Run(ctx, client, cfg.Resync); err != nil {
-			slog.Error("error syncing registry", "err", err)
-			return
+		if err := reg.Run(ctx, client, cfg.Resync); err != nil && !errors.Is(err, context.Canceled) {
+			fail(fmt.Errorf("error syncing registry: %w", err))
 		}
 	})
-	wg.Go(func() {
-		ticker := time.NewTicker(cfg.Interval)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				externalIPs := reg.ParseExternalIPs()
-				externalIPStrings := make([]string, len(externalIPs))
-				for i, ip := range externalIPs {
-					externalIPStrings[i] = ip.String()
-				}
-
-				existingSvc, err := service.Get(ctx, client, cfg.ServiceName, cfg.ServiceNamespace)
-				if err != nil {
-					slog.Error("error getting service", "err", err, "name", cfg.ServiceName, "namespace", cfg.ServiceNamespace)
-					return
-				}
-				if existingSvc == nil { // create service
-					svc := service.New(cfg.ServiceName, externalIPStrings)
-					if err := service.Apply(ctx, client, svc, cfg.ServiceNamespace); err == nil {
-						slog.Info("Service created", "name", cfg.ServiceName, "namespace", cfg.ServiceNamespace, "external_ips", svc.Spec.ExternalIPs)
-					} else {
-						slog.Error("error creating service", "err", err, "name", cfg.ServiceName, "namespace", cfg.ServiceNamespace)
-					}
-				} else { // service exists, may require update
-					if upToDate := slices.Equal(existingSvc.Spec.ExternalIPs, externalIPStrings); upToDate {
-						slog.Debug("Service is already up to date", "name", cfg.ServiceName, "namespace", cfg.ServiceNamespace, "external_ips", existingSvc.Spec.ExternalIPs)
-					} else { // must update
-						svc := service.New(cfg.ServiceName, externalIPStrings)
-						if err := service.Apply(ctx, client, svc, cfg.ServiceNamespace); err == nil {
-							slog.Info("Service updated", "name", cfg.ServiceName, "namespace", cfg.ServiceNamespace, "external_ips", svc.Spec.ExternalIPs)
-						} else {
-							slog.Error("error updating service", "err", err, "name", cfg.ServiceName, "namespace", cfg.ServiceNamespace)
-						}
-					}
-				}
+	if cfg.HTTPAddr != "" {
+		mux := http.NewServeMux()
+		health.Register(mux, reg, rec, time.Duration(cfg.ProbeIntervals)*cfg.Interval)
+		metrics.Register(mux)
+		api.Register(mux, reg, rec, eligibility, cfg.IPFamilyPolicy)
+		wg.Go(func() {
+			if err := server.Run(ctx, cfg.HTTPAddr, mux); err != nil && !errors.Is(err, context.Canceled) {
+				fail(fmt.Errorf("error serving HTTP: %w", err))
+			}
+		})
+	}
+	if cfg.DNSResponder.Zone != "" {
+		responderCfg := cfg.DNSResponder
+		responderCfg.IPs = func() ([]netip.Addr, error) {
+			if !reg.HasSynced() {
+				return nil, reconciler.ErrNotSynced
 			}
+			return reg.ParseExternalIPs(eligibility, cfg.IPFamilyPolicy), nil
 		}
-	})
+		responder := dns.NewResponder(responderCfg)
+		wg.Go(func() {
+			if err := responder.Run(ctx, cfg.DNSResponderAddr); err != nil && !errors.Is(err, context.Canceled) {
+				fail(fmt.Errorf("error serving DNS: %w", err))
+			}
+		})
+	}
+	runControllers := func(ctx context.Context) {
+		var wg sync.WaitGroup
+		for _, run := range controllers {
+			wg.Go(func() {
+				if err := run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+					fail(err)
+				}
+			})
+		}
+		wg.Wait()
+	}
+	if cfg.LeaderElect {
+		wg.Go(func() {
+			if err := leader.Run(ctx, client, cfg.LeaderElection, runControllers); err != nil && !errors.Is(err, context.Canceled) {
+				fail(fmt.Errorf("error in leader election: %w", err))
+			}
+		})
+	} else {
+		wg.Go(func() {
+			runControllers(ctx)
+		})
+	}
 
 	wg.Wait()
+	if err := context.Cause(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		slog.Error("exiting due to unrecoverable error", "err", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/netip"
+
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/node/registry"
+	"github.com/fabiant7t/exips/internal/reconciler"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Registry is the part of the node registry the API exposes.
+type Registry interface {
+	HasSynced() bool
+	Evaluate(eligibility node.Eligibility) []registry.Evaluation
+	ParseExternalIPs(eligibility node.Eligibility, policy node.FamilyPolicy) []netip.Addr
+}
+
+// Reconciler is the part of the reconciler the API exposes.
+type Reconciler interface {
+	Running() bool
+	Targets() []reconciler.TargetStatus
+}
+
+// Node is a node as the API shows it.
+type Node struct {
+	Name                    string               `json:"name"`
+	Ready                   bool                 `json:"ready"`
+	Schedulable             bool                 `json:"schedulable"`
+	ControlPlaneSchedulable bool                 `json:"controlPlaneSchedulable"`
+	Taints                  []corev1.Taint       `json:"taints"`
+	Addresses               []corev1.NodeAddress `json:"addresses"`
+	// PublicIPs are the IPs published if the node is eligible
+	PublicIPs []string `json:"publicIPs"`
+	// RejectedIPs are never published
+	RejectedIPs []RejectedIP `json:"rejectedIPs"`
+	Eligible    bool         `json:"eligible"`
+	// Reason and Message of the rule that excluded the node
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// RejectedIP is an IP of a node that is never published.
+type RejectedIP struct {
+	IP   string                 `json:"ip"`
+	Type corev1.NodeAddressType `json:"type"`
+	// Rule that rejected the IP, e.g. the special-purpose block it is in
+	Rule string `json:"rule"`
+}
+
+// NodesResponse of /v1/nodes.
+type NodesResponse struct {
+	Synced bool   `json:"synced"`
+	Nodes  []Node `json:"nodes"`
+}
+
+// IPsResponse of /v1/ips.
+type IPsResponse struct {
+	Synced bool     `json:"synced"`
+	IPs    []string `json:"ips"`
+}
+
+// TargetsResponse of /v1/targets.
+type TargetsResponse struct {
+	// Running is true if this replica reconciles the targets, the leader
+	Running bool                      `json:"running"`
+	Targets []reconciler.TargetStatus `json:"targets"`
+}
+
+// Register adds the read-only API to the mux:
+//
+//   - /v1/nodes lists every node with its state, addresses and verdict of the
+//     global node eligibility.
+//   - /v1/ips lists the public IPs of the eligible nodes and the static IPs.
+//   - /v1/targets lists the state of the Service of every target.
+func Register(mux *http.ServeMux, reg Registry, rec Reconciler, eligibility node.Eligibility, policy node.FamilyPolicy) {
+	mux.HandleFunc("GET /v1/nodes", func(w http.ResponseWriter, _ *http.Request) {
+		evaluations := reg.Evaluate(eligibility)
+		resp := NodesResponse{Synced: reg.HasSynced(), Nodes: make([]Node, len(evaluations))}
+		for i, e := range evaluations {
+			resp.Nodes[i] = Node{
+				Name:                    e.Node.Name(),
+				Ready:                   e.Node.IsReady(),
+				Schedulable:             e.Node.IsSchedulable(),
+				ControlPlaneSchedulable: e.Node.IsControlPlaneSchedulable(),
+				Taints:                  nonNil(e.Node.Taints()),
+				Addresses:               nonNil(e.Node.Addresses()),
+				PublicIPs:               ipStrings(policy.Select(e.Node.PublicIPs())),
+				RejectedIPs:             rejectedIPs(e.Node.RejectedIPs()),
+				Eligible:                e.Verdict.Eligible,
+				Reason:                  e.Verdict.Reason,
+				Message:                 e.Verdict.Message,
+			}
+		}
+		write(w, resp)
+	})
+	mux.HandleFunc("GET /v1/ips", func(w http.ResponseWriter, _ *http.Request) {
+		write(w, IPsResponse{Synced: reg.HasSynced(), IPs: ipStrings(reg.ParseExternalIPs(eligibility, policy))})
+	})
+	mux.HandleFunc("GET /v1/targets", func(w http.ResponseWriter, _ *http.Request) {
+		targets := nonNil(rec.Targets())
+		for i := range targets {
+			targets[i].PublishedIPs = nonNil(targets[i].PublishedIPs)
+		}
+		write(w, TargetsResponse{Running: rec.Running(), Targets: targets})
+	})
+}
+
+// rejectedIPs formats the rejected IPs, never returning nil so they encode as
+// a list.
+func rejectedIPs(rejected []node.RejectedIP) []RejectedIP {
+	r := make([]RejectedIP, len(rejected))
+	for i, ip := range rejected {
+		r[i] = RejectedIP{IP: ip.IP.String(), Type: ip.Type, Rule: ip.Rule}
+	}
+	return r
+}
+
+// ipStrings formats the IPs, never returning nil so they encode as a list.
+func ipStrings(ips []netip.Addr) []string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	return s
+}
+
+// nonNil returns an empty slice for nil, so it encodes as a list.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+func write(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Debug("error writing API response", "err", err)
+	}
+}
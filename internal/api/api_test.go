@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/node/registry"
+	"github.com/fabiant7t/exips/internal/reconciler"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type dummyRegistry struct {
+	nodes []node.Node
+}
+
+func (r dummyRegistry) HasSynced() bool {
+	return true
+}
+
+func (r dummyRegistry) Evaluate(eligibility node.Eligibility) []registry.Evaluation {
+	evaluations := make([]registry.Evaluation, len(r.nodes))
+	for i, n := range r.nodes {
+		evaluations[i] = registry.Evaluation{Node: n, Verdict: eligibility.Evaluate(n)}
+	}
+	return evaluations
+}
+
+func (r dummyRegistry) ParseExternalIPs(eligibility node.Eligibility, policy node.FamilyPolicy) []netip.Addr {
+	return registry.PublicIPs(r.Evaluate(eligibility), policy, nil)
+}
+
+type dummyReconciler struct {
+	targets []reconciler.TargetStatus
+}
+
+func (r dummyReconciler) Running() bool {
+	return true
+}
+
+func (r dummyReconciler) Targets() []reconciler.TargetStatus {
+	return r.targets
+}
+
+func get(t *testing.T, mux *http.ServeMux, path string, v any) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+	if got, want := rr.Code, http.StatusOK; got != want {
+		t.Fatalf("%s: Got %d, want %d", path, got, want)
+	}
+	if got, want := rr.Header().Get("Content-Type"), "application/json"; got != want {
+		t.Errorf("%s: Got %s, want %s", path, got, want)
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), v); err != nil {
+		t.Fatalf("%s: %s", path, err)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	ip1, ip2 := netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2.3.4.5")
+	now := time.Now()
+	reg := dummyRegistry{nodes: []node.Node{
+		node.NewDummyNode("w-1", true, true, true, &ip1),
+		node.NewDummyNode("w-2", true, false, true, &ip2),
+	}}
+	rec := dummyReconciler{targets: []reconciler.TargetStatus{
+		{Name: "exips", Namespace: "exips", PublishedIPs: []string{"1.2.3.4"}, LastSuccess: &now},
+		{Name: "internal", Namespace: "exips", LastError: "forbidden"},
+	}}
+	mux := http.NewServeMux()
+	Register(mux, reg, rec, node.DefaultEligibility(), node.DefaultFamilyPolicy)
+
+	var nodes NodesResponse
+	get(t, mux, "/v1/nodes", &nodes)
+	if got, want := len(nodes.Nodes), 2; got != want {
+		t.Fatalf("Got %d, want %d", got, want)
+	}
+	w1, w2 := nodes.Nodes[0], nodes.Nodes[1]
+	for _, tc := range []struct {
+		got  any
+		want any
+	}{
+		{nodes.Synced, true},
+		{w1.Eligible, true},
+		{w1.Addresses[0].Address, "1.2.3.4"},
+		{w1.PublicIPs[0], "1.2.3.4"},
+		{len(w1.Taints), 0},
+		{w2.Eligible, false},
+		{w2.Schedulable, false},
+		{w2.Reason, node.ReasonCordoned},
+		{w2.Taints[0].Key, node.TaintUnschedulable},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("Got %v, want %v", tc.got, tc.want)
+		}
+	}
+
+	var ips IPsResponse
+	get(t, mux, "/v1/ips", &ips)
+	if got, want := ips.IPs, []string{"1.2.3.4"}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+
+	var targets TargetsResponse
+	get(t, mux, "/v1/targets", &targets)
+	if got, want := len(targets.Targets), 2; got != want {
+		t.Fatalf("Got %d, want %d", got, want)
+	}
+	if got, want := targets.Targets[0].PublishedIPs, []string{"1.2.3.4"}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	if got, want := targets.Targets[1].LastError, "forbidden"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	if targets.Targets[1].LastSuccess != nil {
+		t.Errorf("Got %v, want no last success", targets.Targets[1].LastSuccess)
+	}
+}
+
+func TestAPIRejectedIPs(t *testing.T) {
+	reg := dummyRegistry{nodes: []node.Node{
+		node.New(&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "w-1"},
+			Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeExternalIP, Address: "100.64.0.1"},
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+				{Type: corev1.NodeInternalIP, Address: "1.2.3.4"},
+			}},
+		}),
+	}}
+	mux := http.NewServeMux()
+	Register(mux, reg, dummyReconciler{}, node.DefaultEligibility(), node.DefaultFamilyPolicy)
+
+	var nodes NodesResponse
+	get(t, mux, "/v1/nodes", &nodes)
+	if got, want := nodes.Nodes[0].PublicIPs, []string{"1.2.3.4"}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	want := []RejectedIP{
+		{IP: "100.64.0.1", Type: corev1.NodeExternalIP, Rule: "100.64.0.0/10 (Shared Address Space)"},
+		{IP: "10.0.0.1", Type: corev1.NodeInternalIP, Rule: "10.0.0.0/8 (Private-Use)"},
+	}
+	if got := nodes.Nodes[0].RejectedIPs; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
@@ -1,11 +1,24 @@
 package config
 
 import (
+	"fmt"
 	"log/slog"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/fabiant7t/exips/internal/dns"
+	"github.com/fabiant7t/exips/internal/leader"
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/node/registry"
+	"github.com/fabiant7t/exips/internal/service"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -17,41 +30,135 @@ const (
 )
 
 type config struct {
-	ServiceName      string
-	ServiceNamespace string
-	KubeConfig       string
-	Interval         time.Duration
-	Resync           time.Duration
-	Debug            bool
+	ServiceName             string
+	ServiceNamespace        string
+	KubeConfig              string
+	IPFamilyPolicy          node.FamilyPolicy
+	Ports                   []corev1.ServicePort
+	ServiceType             corev1.ServiceType
+	Endpoints               service.EndpointAddresses
+	AddressFilter           node.AddressFilter
+	AddressTypes            []corev1.NodeAddressType // node.DefaultAddressTypes if empty
+	ResolveAddresses        bool
+	StaticIPs               []registry.StaticIP
+	DNSName                 string
+	DNS                     dns.RFC2136Config
+	DNSResponder            dns.ResponderConfig // disabled without zone
+	DNSResponderAddr        string
+	Targets                 []Target
+	ExternalIPSets          bool
+	ExternalIPSetNamespaces []string // all namespaces if empty
+	ExternalIPSetPorts      []int32  // any port if empty
+	IngressClass            string
+	GatewayClass            string
+	GatewaySpecAddresses    bool
+	RequireReady            bool
+	ExcludeCordoned         bool
+	ExcludeTaints           []corev1.Taint
+	ExcludeConditions       []corev1.NodeCondition
+	NodeSelector            labels.Selector
+	NodeFieldSelector       fields.Selector
+	IngressPodNamespace     string
+	IngressPodSelector      labels.Selector // nil if ingress pods are not required
+	LeaderElect             bool
+	LeaderElection          leader.Config
+	Debounce                time.Duration
+	Interval                time.Duration
+	Resync                  time.Duration
+	RetryBaseDelay          time.Duration
+	RetryMaxDelay           time.Duration
+	MaxRetries              int
+	HTTPAddr                string
+	ProbeIntervals          int
+	Debug                   bool
 }
 
-func (cfg *config) Client() (kubernetes.Interface, error) {
-	var restConfig *rest.Config
+func (cfg *config) restConfig() (*rest.Config, error) {
 	if cfg.KubeConfig != "" {
 		rc, err := clientcmd.BuildConfigFromFlags("", cfg.KubeConfig)
 		if err != nil {
 			slog.Error("error loading kubeconfig", "err", err, "kubeconfig", cfg.KubeConfig)
 			return nil, err
 		}
-		restConfig = rc
-	} else {
-		rc, err := rest.InClusterConfig()
-		if err != nil {
-			slog.Error("error loding in cluster config", "err", err)
-			return nil, err
-		}
-		restConfig = rc
+		return rc, nil
+	}
+	rc, err := rest.InClusterConfig()
+	if err != nil {
+		slog.Error("error loding in cluster config", "err", err)
+		return nil, err
+	}
+	return rc, nil
+}
+
+func (cfg *config) Client() (kubernetes.Interface, error) {
+	restConfig, err := cfg.restConfig()
+	if err != nil {
+		return nil, err
 	}
 	return kubernetes.NewForConfig(restConfig)
 }
 
+// DynamicClient returns a client for custom resources.
+func (cfg *config) DynamicClient() (dynamic.Interface, error) {
+	restConfig, err := cfg.restConfig()
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(restConfig)
+}
+
+// Eligibility returns the rules deciding which nodes get their IPs published.
+func (cfg *config) Eligibility() node.Eligibility {
+	rules := []node.Eligibility{node.ExcludeAnnotated()}
+	if cfg.RequireReady {
+		rules = append(rules, node.RequireReady())
+	}
+	if cfg.ExcludeCordoned {
+		rules = append(rules, node.ExcludeCordoned())
+	}
+	for _, taint := range cfg.ExcludeTaints {
+		rules = append(rules, node.ExcludeTaint(taint.Key, taint.Effect))
+	}
+	for _, cond := range cfg.ExcludeConditions {
+		rules = append(rules, node.ExcludeCondition(cond.Type, cond.Status))
+	}
+	if !cfg.NodeSelector.Empty() {
+		rules = append(rules, node.RequireLabels(cfg.NodeSelector))
+	}
+	if !cfg.NodeFieldSelector.Empty() {
+		rules = append(rules, node.RequireFields(cfg.NodeFieldSelector))
+	}
+	return node.All(rules...)
+}
+
 func New() (*config, error) {
 	cfg := &config{
 		ServiceName:      DefaultServiceName,
 		ServiceNamespace: DefaultServiceNamespace,
-		Interval:         15 * time.Second,
-		Resync:           1 * time.Minute,
-		Debug:            false,
+		IPFamilyPolicy:   node.DefaultFamilyPolicy,
+		Ports:            service.DefaultPorts(),
+		ServiceType:      corev1.ServiceTypeClusterIP,
+		RequireReady:     true,
+		ExcludeCordoned:  true,
+		ExcludeTaints: []corev1.Taint{
+			{Key: node.TaintControlPlane, Effect: corev1.TaintEffectNoSchedule},
+		},
+		NodeSelector:      labels.Everything(),
+		NodeFieldSelector: fields.Everything(),
+		LeaderElection: leader.Config{
+			Name:          "exips",
+			LeaseDuration: 15 * time.Second,
+			RenewDeadline: 10 * time.Second,
+			RetryPeriod:   2 * time.Second,
+		},
+		Debounce:       1 * time.Second,
+		Interval:       15 * time.Second,
+		Resync:         1 * time.Minute,
+		RetryBaseDelay: 500 * time.Millisecond,
+		RetryMaxDelay:  1 * time.Minute,
+		MaxRetries:     10,
+		ProbeIntervals: 3,
+		Debug:          false,
 	}
 	if v := os.Getenv("SERVICE_NAME"); v != "" {
 		cfg.ServiceName = v
@@ -62,6 +169,213 @@ func New() (*config, error) {
 	if v := os.Getenv("KUBECONFIG"); v != "" {
 		cfg.KubeConfig = v
 	}
+	if v := os.Getenv("IP_FAMILY_POLICY"); v != "" {
+		p, err := node.ParseFamilyPolicy(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.IPFamilyPolicy = p
+	}
+	if v := os.Getenv("PORTS"); v != "" {
+		ports, err := parsePorts(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Ports = ports
+	}
+	if v := os.Getenv("SERVICE_TYPE"); v != "" {
+		serviceType, err := parseServiceType(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ServiceType = serviceType
+	}
+	if v := os.Getenv("ENDPOINTS"); v != "" {
+		endpoints, err := service.ParseEndpointAddresses(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Endpoints = endpoints
+	}
+	if v := os.Getenv("ALLOWED_CIDRS"); v != "" {
+		prefixes, err := parsePrefixes(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.AddressFilter.Allowed = prefixes
+	}
+	if v := os.Getenv("DENIED_CIDRS"); v != "" {
+		prefixes, err := parsePrefixes(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.AddressFilter.Denied = prefixes
+	}
+	if v := os.Getenv("ADDRESS_TYPES"); v != "" {
+		addressTypes, err := node.ParseAddressTypes(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.AddressTypes = addressTypes
+	}
+	if v := os.Getenv("RESOLVE_ADDRESSES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ResolveAddresses = b
+	}
+	if v := os.Getenv("STATIC_IPS"); v != "" {
+		staticIPs, err := registry.ParseStaticIPs(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.StaticIPs = staticIPs
+	}
+	if err := parseDNS(cfg); err != nil {
+		return nil, err
+	}
+	targets, err := parseTargets(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Targets = targets
+	if err := validateDNS(cfg); err != nil {
+		return nil, err
+	}
+	if v := os.Getenv("EXTERNAL_IP_SETS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ExternalIPSets = b
+	}
+	if v := os.Getenv("EXTERNAL_IP_SET_NAMESPACES"); v != "" {
+		cfg.ExternalIPSetNamespaces = parseNames(v)
+	}
+	if v := os.Getenv("EXTERNAL_IP_SET_PORTS"); v != "" {
+		ports, err := parsePortNumbers(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ExternalIPSetPorts = ports
+	}
+	if v := os.Getenv("INGRESS_CLASS"); v != "" {
+		cfg.IngressClass = v
+	}
+	if v := os.Getenv("GATEWAY_CLASS"); v != "" {
+		cfg.GatewayClass = v
+	}
+	if v := os.Getenv("GATEWAY_SPEC_ADDRESSES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GatewaySpecAddresses = b
+	}
+	if v := os.Getenv("REQUIRE_READY"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RequireReady = b
+	}
+	if v := os.Getenv("EXCLUDE_CORDONED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ExcludeCordoned = b
+	}
+	if v, ok := os.LookupEnv("EXCLUDE_TAINTS"); ok { // empty value excludes no taints
+		taints, err := parseTaints(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ExcludeTaints = taints
+	}
+	if v := os.Getenv("EXCLUDE_CONDITIONS"); v != "" {
+		conds, err := parseConditions(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ExcludeConditions = conds
+	}
+	if v := os.Getenv("NODE_SELECTOR"); v != "" {
+		selector, err := labels.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.NodeSelector = selector
+	}
+	if v := os.Getenv("NODE_FIELD_SELECTOR"); v != "" {
+		selector, err := fields.ParseSelector(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.NodeFieldSelector = selector
+	}
+	if v := os.Getenv("INGRESS_POD_NAMESPACE"); v != "" {
+		cfg.IngressPodNamespace = v
+	}
+	if v := os.Getenv("INGRESS_POD_SELECTOR"); v != "" {
+		selector, err := labels.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.IngressPodSelector = selector
+	}
+	if v := os.Getenv("LEADER_ELECT"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.LeaderElect = b
+	}
+	cfg.LeaderElection.Namespace = cfg.ServiceNamespace
+	if v := os.Getenv("LEADER_ELECTION_NAMESPACE"); v != "" {
+		cfg.LeaderElection.Namespace = v
+	}
+	if v := os.Getenv("LEADER_ELECTION_NAME"); v != "" {
+		cfg.LeaderElection.Name = v
+	}
+	if v := os.Getenv("LEADER_ELECTION_IDENTITY"); v != "" {
+		cfg.LeaderElection.Identity = v
+	} else {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		cfg.LeaderElection.Identity = hostname
+	}
+	if v := os.Getenv("LEADER_ELECTION_LEASE_DURATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.LeaderElection.LeaseDuration = d
+	}
+	if v := os.Getenv("LEADER_ELECTION_RENEW_DEADLINE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.LeaderElection.RenewDeadline = d
+	}
+	if v := os.Getenv("LEADER_ELECTION_RETRY_PERIOD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.LeaderElection.RetryPeriod = d
+	}
+	if v := os.Getenv("DEBOUNCE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Debounce = d
+	}
 	if v := os.Getenv("INTERVAL"); v != "" {
 		d, err := time.ParseDuration(v)
 		if err != nil {
@@ -76,6 +390,37 @@ func New() (*config, error) {
 		}
 		cfg.Resync = d
 	}
+	if v := os.Getenv("RETRY_BASE_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RetryBaseDelay = d
+	}
+	if v := os.Getenv("RETRY_MAX_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RetryMaxDelay = d
+	}
+	if v := os.Getenv("MAX_RETRIES"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MaxRetries = i
+	}
+	if v := os.Getenv("HTTP_ADDR"); v != "" {
+		cfg.HTTPAddr = v
+	}
+	if v := os.Getenv("PROBE_INTERVALS"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ProbeIntervals = i
+	}
 	if v := os.Getenv("DEBUG"); v != "" {
 		b, err := strconv.ParseBool(v)
 		if err != nil {
@@ -85,3 +430,94 @@ func New() (*config, error) {
 	}
 	return cfg, nil
 }
+
+// parsePrefixes parses a comma separated list of CIDR prefixes, masking them.
+func parsePrefixes(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", item, err)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// parseNames parses a comma separated list of names.
+func parseNames(s string) []string {
+	var names []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			names = append(names, item)
+		}
+	}
+	return names
+}
+
+// parsePortNumbers parses a comma separated list of port numbers.
+func parsePortNumbers(s string) ([]int32, error) {
+	var ports []int32
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		port, err := strconv.ParseInt(item, 10, 32)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port number %q", item)
+		}
+		ports = append(ports, int32(port))
+	}
+	return ports, nil
+}
+
+// parseTaints parses a comma separated list of taints in the form key or
+// key:effect.
+func parseTaints(s string) ([]corev1.Taint, error) {
+	var taints []corev1.Taint
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, effect, _ := strings.Cut(item, ":")
+		if key == "" {
+			return nil, fmt.Errorf("missing taint key in %q", item)
+		}
+		switch corev1.TaintEffect(effect) {
+		case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			return nil, fmt.Errorf("invalid taint effect %q in %q", effect, item)
+		}
+		taints = append(taints, corev1.Taint{Key: key, Effect: corev1.TaintEffect(effect)})
+	}
+	return taints, nil
+}
+
+// parseConditions parses a comma separated list of node conditions in the
+// form type or type=status. The status defaults to True.
+func parseConditions(s string) ([]corev1.NodeCondition, error) {
+	var conds []corev1.NodeCondition
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		condType, status, ok := strings.Cut(item, "=")
+		if !ok {
+			status = string(corev1.ConditionTrue)
+		}
+		switch corev1.ConditionStatus(status) {
+		case corev1.ConditionTrue, corev1.ConditionFalse, corev1.ConditionUnknown:
+		default:
+			return nil, fmt.Errorf("invalid condition status %q in %q", status, item)
+		}
+		conds = append(conds, corev1.NodeCondition{Type: corev1.NodeConditionType(condType), Status: corev1.ConditionStatus(status)})
+	}
+	return conds, nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	got, err := parsePrefixes("10.1.2.3/8, 2a01:4f8::/32,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2a01:4f8::/32")}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	if _, err := parsePrefixes("10.0.0.0"); err == nil {
+		t.Errorf("Got no error, want error")
+	}
+}
+
+func TestParseTaints(t *testing.T) {
+	got, err := parseTaints("example.com/maintenance, node.kubernetes.io/unreachable:NoExecute,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []corev1.Taint{
+		{Key: "example.com/maintenance"},
+		{Key: "node.kubernetes.io/unreachable", Effect: corev1.TaintEffectNoExecute},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	for _, s := range []string{":NoSchedule", "example.com/maintenance:Never"} {
+		if _, err := parseTaints(s); err == nil {
+			t.Errorf("%s: Got no error, want error", s)
+		}
+	}
+}
+
+func TestParsePortNumbers(t *testing.T) {
+	got, err := parsePortNumbers("80, 443,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int32{80, 443}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	for _, s := range []string{"https", "0", "65536"} {
+		if _, err := parsePortNumbers(s); err == nil {
+			t.Errorf("%s: Got no error, want error", s)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fabiant7t/exips/internal/dns"
+)
+
+// parseDNS reads the name of the global target and the server its records
+// are updated on, shared by all targets, and the zone of the responder.
+func parseDNS(cfg *config) error {
+	if v := os.Getenv("DNS_NAME"); v != "" {
+		if !dns.ValidName(v) {
+			return fmt.Errorf("invalid DNS_NAME %q", v)
+		}
+		cfg.DNSName = v
+	}
+	cfg.DNS.Server = os.Getenv("DNS_SERVER")
+	cfg.DNS.Zone = os.Getenv("DNS_ZONE")
+	cfg.DNS.TSIGKeyName = os.Getenv("DNS_TSIG_KEY_NAME")
+	cfg.DNS.TSIGSecret = os.Getenv("DNS_TSIG_SECRET")
+	cfg.DNS.TSIGAlgorithm = os.Getenv("DNS_TSIG_ALGORITHM")
+	if v := os.Getenv("DNS_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		if d < time.Second {
+			return errors.New("DNS_TTL must be at least 1s")
+		}
+		cfg.DNS.TTL = d
+	}
+	if v := os.Getenv("DNS_RESPONDER_ZONE"); v != "" {
+		if !dns.ValidName(v) {
+			return fmt.Errorf("invalid DNS_RESPONDER_ZONE %q", v)
+		}
+		cfg.DNSResponder.Zone = v
+	}
+	if v := os.Getenv("DNS_RESPONDER_NAMESERVERS"); v != "" {
+		for _, ns := range strings.Split(v, ",") {
+			ns = strings.TrimSpace(ns)
+			if ns == "" {
+				continue
+			}
+			if !dns.ValidName(ns) {
+				return fmt.Errorf("invalid nameserver %q", ns)
+			}
+			cfg.DNSResponder.Nameservers = append(cfg.DNSResponder.Nameservers, ns)
+		}
+	}
+	if v := os.Getenv("DNS_RESPONDER_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		if d < time.Second {
+			return errors.New("DNS_RESPONDER_TTL must be at least 1s")
+		}
+		cfg.DNSResponder.TTL = d
+	}
+	cfg.DNSResponderAddr = ":5353"
+	if v := os.Getenv("DNS_RESPONDER_ADDR"); v != "" {
+		cfg.DNSResponderAddr = v
+	}
+	return nil
+}
+
+// validateDNS requires the server and zone if any target has a DNS name.
+func validateDNS(cfg *config) error {
+	for _, t := range cfg.Targets {
+		if t.DNSName == "" {
+			continue
+		}
+		if cfg.DNS.Server == "" || cfg.DNS.Zone == "" {
+			return errors.New("DNS_SERVER and DNS_ZONE are required for DNS names")
+		}
+		if !dns.InZone(t.DNSName, cfg.DNS.Zone) {
+			return fmt.Errorf("DNS name %s of Service %s is not in DNS_ZONE %s", t.DNSName, t.ServiceName, cfg.DNS.Zone)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fabiant7t/exips/internal/dns"
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/node/registry"
+	"github.com/fabiant7t/exips/internal/service"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Target is a Service the external IPs are published on.
+type Target struct {
+	ServiceName      string
+	ServiceNamespace string
+	NodeSelector     labels.Selector // nodes must match in addition to NODE_SELECTOR
+	IPFamilyPolicy   node.FamilyPolicy
+	AddressTypes     []corev1.NodeAddressType // the global address types if empty
+	StaticIPs        []registry.StaticIP
+	Ports            []corev1.ServicePort
+	ServiceType      corev1.ServiceType
+	Endpoints        service.EndpointAddresses // no EndpointSlices if empty
+	DNSName          string                    // no DNS records if empty
+}
+
+// Eligibility returns the base rules restricted to the nodes of the target.
+func (t Target) Eligibility(base node.Eligibility) node.Eligibility {
+	if t.NodeSelector.Empty() {
+		return base
+	}
+	return node.All(base, node.RequireLabels(t.NodeSelector))
+}
+
+// parseTargets reads the targets listed in TARGETS. Every target is
+// configured by variables prefixed with TARGET_<ID>_, falling back to the
+// global configuration. Without TARGETS, the global configuration is the only
+// target. An empty TARGETS configures no targets, e.g. if all Services are
+// declared by ExternalIPSets.
+func parseTargets(cfg *config) ([]Target, error) {
+	global := Target{
+		ServiceName:      cfg.ServiceName,
+		ServiceNamespace: cfg.ServiceNamespace,
+		NodeSelector:     labels.Everything(),
+		IPFamilyPolicy:   cfg.IPFamilyPolicy,
+		Ports:            cfg.Ports,
+		ServiceType:      cfg.ServiceType,
+		Endpoints:        cfg.Endpoints,
+		DNSName:          cfg.DNSName,
+		StaticIPs:        cfg.StaticIPs,
+	}
+	v, ok := os.LookupEnv("TARGETS")
+	if !ok {
+		return []Target{global}, nil
+	}
+	var targets []Target
+	for _, id := range strings.Split(v, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		t, err := parseTarget(id, global)
+		if err != nil {
+			return nil, fmt.Errorf("error in target %q: %w", id, err)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// parseTarget reads the target from the TARGET_<ID>_ variables. The Service is
+// named after the ID unless configured otherwise.
+func parseTarget(id string, global Target) (Target, error) {
+	prefix := "TARGET_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(id)) + "_"
+	t := global
+	t.ServiceName = id
+	t.DNSName = os.Getenv(prefix + "DNS_NAME") // names are never shared
+	if t.DNSName != "" && !dns.ValidName(t.DNSName) {
+		return Target{}, fmt.Errorf("invalid DNS name %q", t.DNSName)
+	}
+	if v := os.Getenv(prefix + "SERVICE_NAME"); v != "" {
+		t.ServiceName = v
+	}
+	if v := os.Getenv(prefix + "SERVICE_NAMESPACE"); v != "" {
+		t.ServiceNamespace = v
+	}
+	if v := os.Getenv(prefix + "NODE_SELECTOR"); v != "" {
+		selector, err := labels.Parse(v)
+		if err != nil {
+			return Target{}, err
+		}
+		t.NodeSelector = selector
+	}
+	if v := os.Getenv(prefix + "IP_FAMILY_POLICY"); v != "" {
+		p, err := node.ParseFamilyPolicy(v)
+		if err != nil {
+			return Target{}, err
+		}
+		t.IPFamilyPolicy = p
+	}
+	if v := os.Getenv(prefix + "ADDRESS_TYPES"); v != "" {
+		addressTypes, err := node.ParseAddressTypes(v)
+		if err != nil {
+			return Target{}, err
+		}
+		t.AddressTypes = addressTypes
+	}
+	if v, ok := os.LookupEnv(prefix + "STATIC_IPS"); ok { // empty value publishes no static IPs
+		staticIPs, err := registry.ParseStaticIPs(v)
+		if err != nil {
+			return Target{}, err
+		}
+		t.StaticIPs = staticIPs
+	}
+	if v := os.Getenv(prefix + "SERVICE_TYPE"); v != "" {
+		serviceType, err := parseServiceType(v)
+		if err != nil {
+			return Target{}, err
+		}
+		t.ServiceType = serviceType
+	}
+	if v := os.Getenv(prefix + "ENDPOINTS"); v != "" {
+		endpoints, err := service.ParseEndpointAddresses(v)
+		if err != nil {
+			return Target{}, err
+		}
+		t.Endpoints = endpoints
+	}
+	if v := os.Getenv(prefix + "PORTS"); v != "" {
+		ports, err := parsePorts(v)
+		if err != nil {
+			return Target{}, err
+		}
+		t.Ports = ports
+	}
+	return t, nil
+}
+
+// parseServiceType parses the type of the Service, ClusterIP publishing the
+// IPs as external IPs and LoadBalancer in the load balancer status.
+func parseServiceType(s string) (corev1.ServiceType, error) {
+	switch t := corev1.ServiceType(s); t {
+	case corev1.ServiceTypeClusterIP, corev1.ServiceTypeLoadBalancer:
+		return t, nil
+	default:
+		return "", fmt.Errorf("invalid service type %q, want ClusterIP or LoadBalancer", s)
+	}
+}
+
+// parsePorts parses a comma separated list of Service ports in the form
+// name:port[:targetPort][/protocol][@appProtocol], e.g. https:443:websecure or
+// dns:53/UDP. The target port defaults to the port, the protocol to TCP.
+func parsePorts(s string) ([]corev1.ServicePort, error) {
+	var ports []corev1.ServicePort
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		port, err := parsePort(item)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, port)
+	}
+	if len(ports) == 0 {
+		return service.DefaultPorts(), nil
+	}
+	return ports, nil
+}
+
+// parsePort parses a single port, see parsePorts.
+func parsePort(item string) (corev1.ServicePort, error) {
+	s, appProtocol, hasAppProtocol := strings.Cut(item, "@") // may contain a slash
+	s, protocol, hasProtocol := strings.Cut(s, "/")
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return corev1.ServicePort{}, fmt.Errorf("invalid port %q, want name:port[:targetPort][/protocol][@appProtocol]", item)
+	}
+	port, err := strconv.ParseInt(parts[1], 10, 32)
+	if err != nil || port < 1 || port > 65535 {
+		return corev1.ServicePort{}, fmt.Errorf("invalid port number %q in %q", parts[1], item)
+	}
+	p := corev1.ServicePort{
+		Name:       parts[0],
+		Port:       int32(port),
+		Protocol:   corev1.ProtocolTCP,
+		TargetPort: intstr.FromInt32(int32(port)),
+	}
+	if len(parts) == 3 {
+		p.TargetPort = intstr.Parse(parts[2])
+		if parts[2] == "" || p.TargetPort.Type == intstr.Int && (p.TargetPort.IntVal < 1 || p.TargetPort.IntVal > 65535) {
+			return corev1.ServicePort{}, fmt.Errorf("invalid target port %q in %q", parts[2], item)
+		}
+	}
+	if hasProtocol {
+		switch corev1.Protocol(strings.ToUpper(protocol)) {
+		case corev1.ProtocolTCP, corev1.ProtocolUDP, corev1.ProtocolSCTP:
+			p.Protocol = corev1.Protocol(strings.ToUpper(protocol))
+		default:
+			return corev1.ServicePort{}, fmt.Errorf("invalid protocol %q in %q", protocol, item)
+		}
+	}
+	if hasAppProtocol {
+		if appProtocol == "" {
+			return corev1.ServicePort{}, fmt.Errorf("empty app protocol in %q", item)
+		}
+		p.AppProtocol = &appProtocol
+	}
+	return p, nil
+}
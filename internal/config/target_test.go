@@ -0,0 +1,182 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/service"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestParseTargets(t *testing.T) {
+	t.Setenv("TARGETS", "public, internal-lb")
+	t.Setenv("TARGET_PUBLIC_SERVICE_NAME", "traefik")
+	t.Setenv("TARGET_INTERNAL_LB_SERVICE_NAMESPACE", "ingress")
+	t.Setenv("TARGET_INTERNAL_LB_NODE_SELECTOR", "ingress=internal")
+	t.Setenv("TARGET_INTERNAL_LB_IP_FAMILY_POLICY", "DualStack")
+	t.Setenv("TARGET_INTERNAL_LB_PORTS", "http:80,https:443")
+	t.Setenv("TARGET_INTERNAL_LB_SERVICE_TYPE", "LoadBalancer")
+	t.Setenv("TARGET_INTERNAL_LB_ENDPOINTS", "internal")
+	t.Setenv("TARGET_INTERNAL_LB_ADDRESS_TYPES", "ExternalDNS,InternalIP")
+	t.Setenv("STATIC_IPS", "203.0.113.10")
+	t.Setenv("TARGET_INTERNAL_LB_STATIC_IPS", "")
+	cfg, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(cfg.Targets), 2; got != want {
+		t.Fatalf("Got %d, want %d", got, want)
+	}
+	public, internal := cfg.Targets[0], cfg.Targets[1]
+	for _, tc := range []struct {
+		got  any
+		want any
+	}{
+		{public.ServiceName, "traefik"},
+		{public.ServiceNamespace, DefaultServiceNamespace},
+		{public.NodeSelector.String(), ""},
+		{public.IPFamilyPolicy, node.DefaultFamilyPolicy},
+		{public.Ports[0].Name, "dummy"},
+		{public.ServiceType, corev1.ServiceTypeClusterIP},
+		{public.Endpoints, service.EndpointAddresses("")},
+		{len(public.AddressTypes), 0},
+		{public.StaticIPs[0].String(), "203.0.113.10"},
+		{internal.ServiceName, "internal-lb"},
+		{internal.ServiceNamespace, "ingress"},
+		{internal.NodeSelector.String(), "ingress=internal"},
+		{internal.IPFamilyPolicy, node.FamilyPolicyDualStack},
+		{len(internal.Ports), 2},
+		{internal.Ports[1].Port, int32(443)},
+		{internal.ServiceType, corev1.ServiceTypeLoadBalancer},
+		{internal.Endpoints, service.EndpointAddressesInternal},
+		{len(internal.AddressTypes), 2},
+		{internal.AddressTypes[0], corev1.NodeExternalDNS},
+		{len(internal.StaticIPs), 0},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("Got %v, want %v", tc.got, tc.want)
+		}
+	}
+}
+
+func TestParseTargetsDefaultsToGlobalService(t *testing.T) {
+	t.Setenv("SERVICE_NAME", "public")
+	cfg, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(cfg.Targets), 1; got != want {
+		t.Fatalf("Got %d, want %d", got, want)
+	}
+	if got, want := cfg.Targets[0].ServiceName, "public"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+}
+
+func TestParsePorts(t *testing.T) {
+	h2c := "kubernetes.io/h2c"
+	for _, tc := range []struct {
+		s    string
+		want corev1.ServicePort
+	}{
+		{"http:80", corev1.ServicePort{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromInt32(80)}},
+		{"https:443:8443", corev1.ServicePort{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromInt32(8443)}},
+		{"https:443:websecure", corev1.ServicePort{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromString("websecure")}},
+		{"dns:53/udp", corev1.ServicePort{Name: "dns", Port: 53, Protocol: corev1.ProtocolUDP, TargetPort: intstr.FromInt32(53)}},
+		{"grpc:80:8080/TCP@kubernetes.io/h2c", corev1.ServicePort{Name: "grpc", Port: 80, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromInt32(8080), AppProtocol: &h2c}},
+	} {
+		ports, err := parsePorts(tc.s)
+		if err != nil {
+			t.Errorf("%q raised error: %s", tc.s, err)
+			continue
+		}
+		if got, want := ports, []corev1.ServicePort{tc.want}; !equality.Semantic.DeepEqual(got, want) {
+			t.Errorf("%q: Got %+v, want %+v", tc.s, got, want)
+		}
+	}
+	for _, s := range []string{"80", "http:", "http:0", "http:65536", ":80", "http:80:", "http:80:0", "http:80/ICMP", "http:80@", "http:80:8080:8081"} {
+		if _, err := parsePorts(s); err == nil {
+			t.Errorf("%q: Got nil, want error", s)
+		}
+	}
+}
+
+func TestParseTargetsEmpty(t *testing.T) {
+	t.Setenv("TARGETS", "")
+	cfg, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(cfg.Targets), 0; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+}
+
+func TestParseTargetsDNS(t *testing.T) {
+	t.Setenv("DNS_NAME", "ingress.example.com")
+	t.Setenv("DNS_SERVER", "ns1.example.com:53")
+	t.Setenv("DNS_ZONE", "example.com")
+	cfg, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.Targets[0].DNSName, "ingress.example.com"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+
+	// names are never shared with the targets
+	t.Setenv("TARGETS", "public,internal")
+	t.Setenv("TARGET_INTERNAL_DNS_NAME", "internal.example.com")
+	cfg, err = New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.Targets[0].DNSName, ""; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	if got, want := cfg.Targets[1].DNSName, "internal.example.com"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+
+	t.Setenv("TARGET_INTERNAL_DNS_NAME", "internal.example.org")
+	if _, err := New(); err == nil {
+		t.Error("name outside of the zone did not raise error")
+	}
+	t.Setenv("TARGET_INTERNAL_DNS_NAME", "internal.example.com")
+	t.Setenv("DNS_SERVER", "")
+	if _, err := New(); err == nil {
+		t.Error("missing server did not raise error")
+	}
+}
+
+func TestParseDNSResponder(t *testing.T) {
+	t.Setenv("DNS_RESPONDER_ZONE", "ingress.example.com")
+	t.Setenv("DNS_RESPONDER_NAMESERVERS", "ns1.example.com, ns2.example.com")
+	t.Setenv("DNS_RESPONDER_TTL", "10s")
+	cfg, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		got  any
+		want any
+	}{
+		{cfg.DNSResponder.Zone, "ingress.example.com"},
+		{len(cfg.DNSResponder.Nameservers), 2},
+		{cfg.DNSResponder.Nameservers[1], "ns2.example.com"},
+		{cfg.DNSResponder.TTL, 10 * time.Second},
+		{cfg.DNSResponderAddr, ":5353"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("Got %v, want %v", tc.got, tc.want)
+		}
+	}
+	t.Setenv("DNS_RESPONDER_TTL", "0s")
+	if _, err := New(); err == nil {
+		t.Error("TTL of 0s did not raise error")
+	}
+}
@@ -0,0 +1,105 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+)
+
+// VerifyInterval is how long a Sink trusts its last publish. Until then,
+// publishing the same IPs again sends nothing to the server, afterwards the
+// records are queried again, so manual changes are corrected.
+const VerifyInterval = 10 * time.Minute
+
+// Record is an A or AAAA record.
+type Record struct {
+	IP  netip.Addr
+	TTL time.Duration
+}
+
+// Provider manages the A and AAAA records of DNS names.
+type Provider interface {
+	// Records returns the A and AAAA records of the name.
+	Records(ctx context.Context, name string) ([]Record, error)
+	// Update replaces the A and AAAA records of the name with the IPs. No
+	// IPs remove the records.
+	Update(ctx context.Context, name string, ips []netip.Addr) error
+	// TTL of the records written by Update.
+	TTL() time.Duration
+}
+
+// Sink keeps the A and AAAA records of a DNS name equal to the published IPs.
+type Sink struct {
+	provider Provider
+	name     string
+
+	mu        sync.Mutex
+	last      []netip.Addr // of the last successful publish
+	published time.Time    // of the last successful publish, zero if none
+}
+
+// NewSink creates a Sink for the name, managed by the provider.
+func NewSink(provider Provider, name string) *Sink {
+	return &Sink{provider: provider, name: name}
+}
+
+// Publish updates the records of the name unless they already equal the IPs,
+// regardless of their order, and have the TTL of the provider. Within
+// VerifyInterval of the last successful publish of the same IPs, the records
+// are not even queried.
+func (s *Sink) Publish(ctx context.Context, ips []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	want := make([]netip.Addr, 0, len(ips))
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return fmt.Errorf("error parsing IP %q: %w", ip, err)
+		}
+		want = append(want, addr.Unmap())
+	}
+	if !s.published.IsZero() && time.Since(s.published) < VerifyInterval && equal(s.last, want) {
+		return nil
+	}
+	s.published = time.Time{} // unless this publish succeeds
+	got, err := s.provider.Records(ctx, s.name)
+	if err != nil {
+		return fmt.Errorf("error looking up records of %s: %w", s.name, err)
+	}
+	if s.upToDate(got, want) {
+		slog.Debug("DNS records are already up to date", "name", s.name, "ips", ips)
+	} else {
+		if err := s.provider.Update(ctx, s.name, want); err != nil {
+			return fmt.Errorf("error updating records of %s: %w", s.name, err)
+		}
+		slog.Info("DNS records updated", "name", s.name, "ips", ips, "ttl", s.provider.TTL())
+	}
+	s.last, s.published = want, time.Now()
+	return nil
+}
+
+// upToDate returns true if the records have the IPs and all of them the TTL
+// of the provider.
+func (s *Sink) upToDate(records []Record, ips []netip.Addr) bool {
+	got := make([]netip.Addr, len(records))
+	for i, r := range records {
+		if r.TTL != s.provider.TTL() {
+			return false
+		}
+		got[i] = r.IP
+	}
+	return equal(got, ips)
+}
+
+// equal returns true if both hold the same IPs, regardless of their order.
+func equal(a, b []netip.Addr) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.SortFunc(a, netip.Addr.Compare)
+	slices.SortFunc(b, netip.Addr.Compare)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
@@ -0,0 +1,197 @@
+package dns
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultResponderTTL of the answers, short so resolvers follow changes of
+// the eligible nodes quickly.
+const DefaultResponderTTL = 30 * time.Second
+
+// ResponderConfig configures the Responder.
+type ResponderConfig struct {
+	// Zone delegated to the responder, its apex has the IPs
+	Zone string
+	// Nameservers of the zone, the apex if empty
+	Nameservers []string
+	// TTL of the answers, DefaultResponderTTL if zero
+	TTL time.Duration
+	// IPs returns the current IPs, an error makes the responder fail the
+	// query, e.g. before the nodes are known
+	IPs func() ([]netip.Addr, error)
+}
+
+// Responder is a minimal authoritative DNS server for a delegated zone. It
+// answers A and AAAA queries of the apex with the current IPs, and SOA and NS
+// queries. Other names of the zone do not exist, other zones are refused.
+type Responder struct {
+	cfg ResponderConfig
+
+	mu     sync.Mutex
+	ips    []netip.Addr // of the last answer
+	serial uint32       // changes with the IPs
+}
+
+// NewResponder creates a Responder for the zone.
+func NewResponder(cfg ResponderConfig) *Responder {
+	cfg.Zone = dns.CanonicalName(cfg.Zone)
+	if len(cfg.Nameservers) == 0 {
+		cfg.Nameservers = []string{cfg.Zone}
+	}
+	for i, ns := range cfg.Nameservers {
+		cfg.Nameservers[i] = dns.CanonicalName(ns)
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultResponderTTL
+	}
+	return &Responder{cfg: cfg, serial: uint32(time.Now().Unix())}
+}
+
+// Run serves DNS on the address via UDP and TCP until the context is done.
+func (r *Responder) Run(ctx context.Context, addr string) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		pc.Close()
+		return err
+	}
+	var started sync.WaitGroup
+	servers := []*dns.Server{
+		{PacketConn: pc, Handler: r, NotifyStartedFunc: started.Done},
+		{Listener: l, Handler: r, NotifyStartedFunc: started.Done},
+	}
+	started.Add(len(servers))
+	errCh := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() {
+			errCh <- srv.ActivateAndServe()
+		}()
+	}
+	started.Wait() // shutting down a server that did not start fails
+	slog.Info("DNS responder listening", "addr", addr, "zone", r.cfg.Zone)
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+	}
+	for _, srv := range servers {
+		srv.Shutdown() // fails if the server is done already
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// ServeDNS answers a query. Answers over UDP are truncated to the size the
+// client accepts, so it retries over TCP if there are too many IPs. Answers
+// to EDNS0 queries carry an OPT record with the negotiated size.
+func (r *Responder) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	m := r.answer(req)
+	if req.IsEdns0() != nil {
+		m.SetEdns0(uint16(udpSize(req)), false)
+	}
+	if _, udp := w.RemoteAddr().(*net.UDPAddr); udp {
+		m.Truncate(udpSize(req))
+	}
+	w.WriteMsg(m)
+}
+
+// udpSize returns the size of the largest UDP answer the client accepts, 512
+// bytes unless it advertises more with EDNS0.
+func udpSize(req *dns.Msg) int {
+	if opt := req.IsEdns0(); opt != nil {
+		return max(int(opt.UDPSize()), dns.MinMsgSize)
+	}
+	return dns.MinMsgSize
+}
+
+// answer returns the response to the query.
+func (r *Responder) answer(req *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	if req.Opcode != dns.OpcodeQuery || len(req.Question) != 1 {
+		m.SetRcode(req, dns.RcodeNotImplemented)
+		return m
+	}
+	q := req.Question[0]
+	name := dns.CanonicalName(q.Name)
+	if !dns.IsSubDomain(r.cfg.Zone, name) {
+		m.SetRcode(req, dns.RcodeRefused)
+		return m
+	}
+	m.Authoritative = true
+	ips, err := r.cfg.IPs()
+	if err != nil {
+		slog.Debug("DNS query failed", "name", q.Name, "err", err)
+		m.SetRcode(req, dns.RcodeServerFailure)
+		m.Authoritative = false
+		return m
+	}
+	soa := r.soa(ips)
+	if name != r.cfg.Zone {
+		m.SetRcode(req, dns.RcodeNameError)
+		m.Ns = []dns.RR{soa}
+		return m
+	}
+	switch q.Qtype {
+	case dns.TypeA, dns.TypeAAAA, dns.TypeANY:
+		for _, ip := range ips {
+			if ip.Is4() && q.Qtype != dns.TypeAAAA {
+				m.Answer = append(m.Answer, &dns.A{Hdr: r.header(dns.TypeA), A: ip.AsSlice()})
+			}
+			if ip.Is6() && q.Qtype != dns.TypeA {
+				m.Answer = append(m.Answer, &dns.AAAA{Hdr: r.header(dns.TypeAAAA), AAAA: ip.AsSlice()})
+			}
+		}
+	case dns.TypeSOA:
+		m.Answer = []dns.RR{soa}
+	case dns.TypeNS:
+		for _, ns := range r.cfg.Nameservers {
+			m.Answer = append(m.Answer, &dns.NS{Hdr: r.header(dns.TypeNS), Ns: ns})
+		}
+	}
+	if len(m.Answer) == 0 { // no data
+		m.Ns = []dns.RR{soa}
+	}
+	return m
+}
+
+// header of the records of the apex.
+func (r *Responder) header(rrtype uint16) dns.RR_Header {
+	return dns.RR_Header{Name: r.cfg.Zone, Rrtype: rrtype, Class: dns.ClassINET, Ttl: uint32(r.cfg.TTL.Seconds())}
+}
+
+// soa returns the SOA record of the zone, with a serial that changes whenever
+// the IPs change.
+func (r *Responder) soa(ips []netip.Addr) *dns.SOA {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !slices.Equal(r.ips, ips) {
+		r.ips = slices.Clone(ips)
+		r.serial = max(r.serial+1, uint32(time.Now().Unix()))
+	}
+	ttl := uint32(r.cfg.TTL.Seconds())
+	return &dns.SOA{
+		Hdr:     r.header(dns.TypeSOA),
+		Ns:      r.cfg.Nameservers[0],
+		Mbox:    "hostmaster." + r.cfg.Zone,
+		Serial:  r.serial,
+		Refresh: ttl,
+		Retry:   ttl,
+		Expire:  3600,
+		Minttl:  ttl, // negative caching
+	}
+}
@@ -0,0 +1,205 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func testResponder(ips []netip.Addr, err error) *Responder {
+	return NewResponder(ResponderConfig{
+		Zone:        "ingress.example.com",
+		Nameservers: []string{"ns1.example.com"},
+		IPs: func() ([]netip.Addr, error) {
+			return ips, err
+		},
+	})
+}
+
+func query(name string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	return m
+}
+
+func TestResponderAnswer(t *testing.T) {
+	r := testResponder([]netip.Addr{netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2.3.4.5"), netip.MustParseAddr("2001:db8::1")}, nil)
+	for _, tc := range []struct {
+		name      string
+		qtype     uint16
+		rcode     int
+		answers   int
+		authority int
+	}{
+		{"ingress.example.com.", dns.TypeA, dns.RcodeSuccess, 2, 0},
+		{"Ingress.Example.com.", dns.TypeAAAA, dns.RcodeSuccess, 1, 0},
+		{"ingress.example.com.", dns.TypeSOA, dns.RcodeSuccess, 1, 0},
+		{"ingress.example.com.", dns.TypeNS, dns.RcodeSuccess, 1, 0},
+		{"ingress.example.com.", dns.TypeMX, dns.RcodeSuccess, 0, 1},
+		{"www.ingress.example.com.", dns.TypeA, dns.RcodeNameError, 0, 1},
+		{"example.com.", dns.TypeA, dns.RcodeRefused, 0, 0},
+	} {
+		m := r.answer(query(tc.name, tc.qtype))
+		if got, want := m.Rcode, tc.rcode; got != want {
+			t.Errorf("%s %s: Got %s, want %s", tc.name, dns.TypeToString[tc.qtype], dns.RcodeToString[got], dns.RcodeToString[want])
+		}
+		if got, want := len(m.Answer), tc.answers; got != want {
+			t.Errorf("%s %s: Got %d answers, want %d", tc.name, dns.TypeToString[tc.qtype], got, want)
+		}
+		if got, want := len(m.Ns), tc.authority; got != want {
+			t.Errorf("%s %s: Got %d authority records, want %d", tc.name, dns.TypeToString[tc.qtype], got, want)
+		}
+		if got, want := m.Authoritative, tc.rcode != dns.RcodeRefused; got != want {
+			t.Errorf("%s %s: Got authoritative %t, want %t", tc.name, dns.TypeToString[tc.qtype], got, want)
+		}
+	}
+}
+
+func TestResponderSerialFollowsIPs(t *testing.T) {
+	ips := []netip.Addr{netip.MustParseAddr("1.2.3.4")}
+	r := NewResponder(ResponderConfig{
+		Zone: "ingress.example.com",
+		IPs: func() ([]netip.Addr, error) {
+			return ips, nil
+		},
+	})
+	serial := func() uint32 {
+		return r.answer(query("ingress.example.com.", dns.TypeSOA)).Answer[0].(*dns.SOA).Serial
+	}
+	first := serial()
+	if got, want := serial(), first; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+	ips = nil
+	if got := serial(); got <= first {
+		t.Errorf("Got %d, want more than %d", got, first)
+	}
+	if got, want := r.answer(query("ingress.example.com.", dns.TypeNS)).Answer[0].(*dns.NS).Ns, "ingress.example.com."; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+}
+
+func TestResponderFailsUntilSynced(t *testing.T) {
+	r := testResponder(nil, errors.New("not synced"))
+	if got, want := r.answer(query("ingress.example.com.", dns.TypeA)).Rcode, dns.RcodeServerFailure; got != want {
+		t.Errorf("Got %s, want %s", dns.RcodeToString[got], dns.RcodeToString[want])
+	}
+}
+
+func TestResponderRun(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.LocalAddr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := testResponder([]netip.Addr{netip.MustParseAddr("1.2.3.4")}, nil)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- r.Run(ctx, addr)
+	}()
+	for _, network := range []string{"udp", "tcp"} {
+		var resp *dns.Msg
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			c := &dns.Client{Net: network, Timeout: time.Second}
+			if resp, _, err = c.Exchange(query("ingress.example.com.", dns.TypeA), addr); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", network, err)
+		}
+		if got, want := resp.Answer[0].(*dns.A).A.String(), "1.2.3.4"; got != want {
+			t.Errorf("%s: Got %s, want %s", network, got, want)
+		}
+	}
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Errorf("Got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestResponderTruncatesUDP(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.LocalAddr().String()
+	l.Close()
+
+	var ips []netip.Addr
+	for i := range 100 {
+		ips = append(ips, netip.AddrFrom4([4]byte{1, 2, 3, byte(i)}))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go testResponder(ips, nil).Run(ctx, addr)
+
+	exchange := func(network string, req *dns.Msg) *dns.Msg {
+		t.Helper()
+		var resp *dns.Msg
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			c := &dns.Client{Net: network, Timeout: time.Second}
+			if resp, _, err = c.Exchange(req, addr); err == nil {
+				return resp
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("%s: %s", network, err)
+		return nil
+	}
+
+	resp := exchange("udp", query("ingress.example.com.", dns.TypeA))
+	if !resp.Truncated {
+		t.Error("Got not truncated, want truncated")
+	}
+	if got := len(resp.Answer); got == 0 || got >= len(ips) {
+		t.Errorf("Got %d answers, want less than %d", got, len(ips))
+	}
+	if opt := resp.IsEdns0(); opt != nil {
+		t.Errorf("Got %v, want no OPT record", opt)
+	}
+
+	req := query("ingress.example.com.", dns.TypeA)
+	req.SetEdns0(4096, false)
+	resp = exchange("udp", req)
+	if got, want := resp.Truncated, false; got != want {
+		t.Errorf("Got truncated %t, want %t", got, want)
+	}
+	if got, want := len(resp.Answer), len(ips); got != want {
+		t.Errorf("Got %d answers, want %d", got, want)
+	}
+	opt := resp.IsEdns0()
+	if opt == nil {
+		t.Fatal("Got no OPT record, want one")
+	}
+	if got, want := opt.UDPSize(), uint16(4096); got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+
+	// the truncated answer keeps the OPT record
+	req = query("ingress.example.com.", dns.TypeA)
+	req.SetEdns0(1232, false)
+	resp = exchange("udp", req)
+	if !resp.Truncated {
+		t.Error("Got not truncated, want truncated")
+	}
+	if opt := resp.IsEdns0(); opt == nil || opt.UDPSize() != 1232 {
+		t.Errorf("Got %v, want OPT record with size 1232", opt)
+	}
+
+	resp = exchange("tcp", query("ingress.example.com.", dns.TypeA))
+	if got, want := len(resp.Answer), len(ips); got != want {
+		t.Errorf("Got %d answers, want %d", got, want)
+	}
+}
@@ -0,0 +1,153 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultTTL of the records.
+const DefaultTTL = time.Minute
+
+// DefaultTSIGAlgorithm signs the updates unless configured otherwise.
+const DefaultTSIGAlgorithm = "hmac-sha256"
+
+// RFC2136Config configures the RFC2136 provider.
+type RFC2136Config struct {
+	// Server is the host:port of the primary server of the zone
+	Server string
+	// Zone the names belong to
+	Zone string
+	// TTL of the records, DefaultTTL if zero
+	TTL time.Duration
+	// TSIGKeyName, TSIGSecret (base64) and TSIGAlgorithm sign the messages,
+	// no signature if the key name is empty
+	TSIGKeyName   string
+	TSIGSecret    string
+	TSIGAlgorithm string
+}
+
+// RFC2136 is a Provider sending dynamic updates (RFC 2136) signed with TSIG
+// (RFC 8945) to the primary server of the zone, so it works with any
+// standards compliant server like BIND, Knot or PowerDNS. It uses TCP.
+type RFC2136 struct {
+	cfg    RFC2136Config
+	client *dns.Client
+}
+
+// NewRFC2136 creates an RFC2136 provider.
+func NewRFC2136(cfg RFC2136Config) *RFC2136 {
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.TSIGAlgorithm == "" {
+		cfg.TSIGAlgorithm = DefaultTSIGAlgorithm
+	}
+	cfg.Zone = dns.Fqdn(cfg.Zone)
+	client := &dns.Client{Net: "tcp"}
+	if cfg.TSIGKeyName != "" {
+		cfg.TSIGKeyName = dns.CanonicalName(cfg.TSIGKeyName)
+		client.TsigSecret = map[string]string{cfg.TSIGKeyName: cfg.TSIGSecret}
+	}
+	return &RFC2136{cfg: cfg, client: client}
+}
+
+// TTL of the records written by Update, in whole seconds.
+func (p *RFC2136) TTL() time.Duration {
+	return p.cfg.TTL.Truncate(time.Second)
+}
+
+// Records queries the A and AAAA records of the name at the primary server,
+// which never serves stale records or decremented TTLs like a secondary or a
+// resolver would.
+func (p *RFC2136) Records(ctx context.Context, name string) ([]Record, error) {
+	var records []Record
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		m := new(dns.Msg)
+		m.SetQuestion(dns.Fqdn(name), qtype)
+		r, err := p.exchange(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		if r.Rcode == dns.RcodeNameError {
+			return nil, nil
+		}
+		if r.Rcode != dns.RcodeSuccess {
+			return nil, fmt.Errorf("error querying %s %s: %s", name, dns.TypeToString[qtype], dns.RcodeToString[r.Rcode])
+		}
+		for _, rr := range r.Answer {
+			ttl := time.Duration(rr.Header().Ttl) * time.Second
+			switch rr := rr.(type) {
+			case *dns.A:
+				if ip, ok := netip.AddrFromSlice(rr.A.To4()); ok {
+					records = append(records, Record{IP: ip, TTL: ttl})
+				}
+			case *dns.AAAA:
+				if ip, ok := netip.AddrFromSlice(rr.AAAA); ok {
+					records = append(records, Record{IP: ip, TTL: ttl})
+				}
+			}
+		}
+	}
+	return records, nil
+}
+
+// Update replaces the A and AAAA records of the name in a single update, so
+// the server applies it atomically.
+func (p *RFC2136) Update(ctx context.Context, name string, ips []netip.Addr) error {
+	name = dns.Fqdn(name)
+	if !InZone(name, p.cfg.Zone) {
+		return fmt.Errorf("error: %s is not in zone %s", name, p.cfg.Zone)
+	}
+	m := new(dns.Msg)
+	m.SetUpdate(p.cfg.Zone)
+	m.RemoveRRset([]dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET}},
+		&dns.AAAA{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET}},
+	})
+	rrs := make([]dns.RR, 0, len(ips))
+	ttl := uint32(p.TTL().Seconds())
+	for _, ip := range ips {
+		if ip.Is4() {
+			rrs = append(rrs, &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl}, A: ip.AsSlice()})
+		} else {
+			rrs = append(rrs, &dns.AAAA{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: ttl}, AAAA: ip.AsSlice()})
+		}
+	}
+	m.Insert(rrs)
+	r, err := p.exchange(ctx, m)
+	if err != nil {
+		return err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("error updating %s: %s", name, dns.RcodeToString[r.Rcode])
+	}
+	return nil
+}
+
+// ValidName returns true if the name is a valid domain name.
+func ValidName(name string) bool {
+	_, ok := dns.IsDomainName(name)
+	return ok
+}
+
+// InZone returns true if the name is the zone or a name in the zone.
+func InZone(name, zone string) bool {
+	return dns.IsSubDomain(dns.Fqdn(zone), dns.Fqdn(name))
+}
+
+// exchange signs the message if a TSIG key is configured and sends it to the
+// server.
+func (p *RFC2136) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	if p.cfg.TSIGKeyName != "" {
+		m.SetTsig(p.cfg.TSIGKeyName, dns.Fqdn(p.cfg.TSIGAlgorithm), 300, time.Now().Unix())
+	}
+	r, _, err := p.client.ExchangeContext(ctx, m, p.cfg.Server)
+	if err != nil {
+		return nil, fmt.Errorf("error sending DNS message to %s: %w", p.cfg.Server, err)
+	}
+	return r, nil
+}
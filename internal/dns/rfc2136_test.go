@@ -0,0 +1,213 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testKeyName = "exips."
+	testSecret  = "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0IQ=="
+)
+
+// zone is a primary server stand-in, applying TSIG signed updates to the
+// records it serves.
+type zone struct {
+	mu      sync.Mutex
+	records []dns.RR
+	updates int
+	queries int
+}
+
+func (z *zone) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	r := new(dns.Msg)
+	r.SetReply(req)
+	if req.IsTsig() != nil {
+		if w.TsigStatus() != nil {
+			r.Rcode = dns.RcodeNotAuth
+		} else {
+			r.SetTsig(testKeyName, dns.HmacSHA256, 300, time.Now().Unix())
+		}
+	}
+	switch {
+	case r.Rcode != dns.RcodeSuccess:
+	case req.Opcode == dns.OpcodeUpdate && req.IsTsig() == nil:
+		r.Rcode = dns.RcodeRefused
+	case req.Opcode == dns.OpcodeUpdate:
+		z.updates++
+		for _, rr := range req.Ns {
+			h := rr.Header()
+			switch h.Class {
+			case dns.ClassANY: // delete the RRset
+				z.records = slices.DeleteFunc(z.records, func(r dns.RR) bool {
+					return r.Header().Name == h.Name && r.Header().Rrtype == h.Rrtype
+				})
+			case dns.ClassINET:
+				z.records = append(z.records, rr)
+			}
+		}
+	default:
+		z.queries++
+		q := req.Question[0]
+		for _, rr := range z.records {
+			if rr.Header().Name == q.Name && rr.Header().Rrtype == q.Qtype {
+				r.Answer = append(r.Answer, rr)
+			}
+		}
+	}
+	w.WriteMsg(r)
+}
+
+func serve(t *testing.T, z *zone) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{
+		Listener:          l,
+		Handler:           z,
+		TsigSecret:        map[string]string{testKeyName: testSecret},
+		NotifyStartedFunc: func() { close(started) },
+		MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction {
+			return dns.MsgAccept
+		},
+	}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	<-started
+	return l.Addr().String()
+}
+
+func TestRFC2136(t *testing.T) {
+	z := &zone{}
+	p := NewRFC2136(RFC2136Config{
+		Server:      serve(t, z),
+		Zone:        "example.com",
+		TSIGKeyName: "exips",
+		TSIGSecret:  testSecret,
+	})
+	sink := NewSink(p, "ingress.example.com")
+	ctx := context.Background()
+
+	for _, ips := range [][]string{
+		{"1.2.3.4", "2001:db8::1"},
+		{"2001:db8::1", "1.2.3.4"}, // same set, no update
+		{"2.3.4.5"},
+		nil,
+	} {
+		if err := sink.Publish(ctx, ips); err != nil {
+			t.Fatal(err)
+		}
+		if got := records(t, p, "ingress.example.com"); !equal(got, addrs(ips)) {
+			t.Errorf("Got %v, want %v", got, ips)
+		}
+	}
+	if got, want := z.updates, 3; got != want {
+		t.Errorf("Got %d updates, want %d", got, want)
+	}
+	if got := z.records; len(got) != 0 {
+		t.Errorf("Got %v, want no records", got)
+	}
+}
+
+func TestSinkUpdatesTTL(t *testing.T) {
+	z := &zone{}
+	server := serve(t, z)
+	ctx := context.Background()
+	ips := []string{"1.2.3.4"}
+	p := NewRFC2136(RFC2136Config{Server: server, Zone: "example.com", TSIGKeyName: "exips", TSIGSecret: testSecret})
+	if err := NewSink(p, "ingress.example.com").Publish(ctx, ips); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restart with another TTL
+	p = NewRFC2136(RFC2136Config{Server: server, Zone: "example.com", TTL: 5 * time.Minute, TSIGKeyName: "exips", TSIGSecret: testSecret})
+	if err := NewSink(p, "ingress.example.com").Publish(ctx, ips); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := z.updates, 2; got != want {
+		t.Errorf("Got %d updates, want %d", got, want)
+	}
+	got, err := p.Records(ctx, "ingress.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Record{{IP: netip.MustParseAddr("1.2.3.4"), TTL: 5 * time.Minute}}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func TestSinkSkipsQueriesOfUnchangedIPs(t *testing.T) {
+	z := &zone{}
+	p := NewRFC2136(RFC2136Config{Server: serve(t, z), Zone: "example.com", TSIGKeyName: "exips", TSIGSecret: testSecret})
+	sink := NewSink(p, "ingress.example.com")
+	ctx := context.Background()
+	for range 3 {
+		if err := sink.Publish(ctx, []string{"1.2.3.4"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := z.queries, 2; got != want { // A and AAAA once
+		t.Errorf("Got %d queries, want %d", got, want)
+	}
+	if err := sink.Publish(ctx, []string{"2.3.4.5"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := z.updates, 2; got != want {
+		t.Errorf("Got %d updates, want %d", got, want)
+	}
+}
+
+// records returns the IPs of the records of the name or fails the test.
+func records(t *testing.T, p *RFC2136, name string) []netip.Addr {
+	t.Helper()
+	got, err := p.Records(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips := make([]netip.Addr, len(got))
+	for i, r := range got {
+		ips[i] = r.IP
+	}
+	return ips
+}
+
+// addrs parses the IPs.
+func addrs(ips []string) []netip.Addr {
+	parsed := make([]netip.Addr, len(ips))
+	for i, ip := range ips {
+		parsed[i] = netip.MustParseAddr(ip)
+	}
+	return parsed
+}
+
+func TestRFC2136RejectsWrongSecret(t *testing.T) {
+	p := NewRFC2136(RFC2136Config{
+		Server:      serve(t, &zone{}),
+		Zone:        "example.com",
+		TSIGKeyName: "exips",
+		TSIGSecret:  "d3Jvbmc=",
+	})
+	if err := p.Update(context.Background(), "ingress.example.com", []netip.Addr{netip.MustParseAddr("1.2.3.4")}); err == nil {
+		t.Error("update with wrong secret did not raise error")
+	}
+}
+
+func TestRFC2136RejectsNameOutsideZone(t *testing.T) {
+	p := NewRFC2136(RFC2136Config{Server: "127.0.0.1:1", Zone: "example.com"})
+	if err := p.Update(context.Background(), "ingress.example.org", nil); err == nil {
+		t.Error("name outside of the zone did not raise error")
+	}
+}
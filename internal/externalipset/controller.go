@@ -0,0 +1,503 @@
+package externalipset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fabiant7t/exips/internal/metrics"
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/node/registry"
+	"github.com/fabiant7t/exips/internal/reconciler"
+	"github.com/fabiant7t/exips/internal/service"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// errInvalidSpec is wrapped by errors of the spec, retrying cannot fix them.
+var errInvalidSpec = errors.New("invalid spec")
+
+// Config of the Controller.
+type Config struct {
+	// Eligibility is the global node eligibility every ExternalIPSet
+	// restricts further
+	Eligibility node.Eligibility
+	// Targets of the configuration, whose Services no ExternalIPSet may
+	// publish
+	Targets []reconciler.Target
+	// Namespaces whose ExternalIPSets are published, all if empty
+	Namespaces []string
+	// Ports the Services of ExternalIPSets may have, any if empty
+	Ports []int32
+	// StaticIPs are published next to the IPs of the nodes
+	StaticIPs []registry.StaticIP
+	// Debounce is the delay between a change of the registry and the
+	// reconcile
+	Debounce time.Duration
+	// Interval of the safety resync
+	Interval time.Duration
+	// RetryBaseDelay is the delay before the first retry of a failed
+	// reconcile, doubling with every further retry up to RetryMaxDelay
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// MaxRetries of a failing reconcile before giving up on the
+	// ExternalIPSet until the next change or resync, 0 retries forever
+	MaxRetries int
+}
+
+// Controller publishes the public IPs of the eligible nodes on the Services
+// declared by ExternalIPSets, and reports them in their status.
+type Controller struct {
+	client  kubernetes.Interface
+	dynamic dynamic.Interface
+	reg     *registry.Registry
+	cfg     Config
+
+	mu        sync.Mutex
+	queue     workqueue.TypedRateLimitingInterface[string] // nil unless running
+	lister    cache.GenericLister                          // nil unless running
+	published map[string]string                            // Service keys by ExternalIPSet key
+}
+
+// New creates a Controller for all ExternalIPSets of the cluster.
+func New(client kubernetes.Interface, dynamicClient dynamic.Interface, reg *registry.Registry, cfg Config) *Controller {
+	c := &Controller{
+		client:    client,
+		dynamic:   dynamicClient,
+		reg:       reg,
+		cfg:       cfg,
+		published: make(map[string]string),
+	}
+	reg.Subscribe(c.Trigger)
+	return c
+}
+
+// Trigger schedules a reconcile of all ExternalIPSets after the debounce
+// duration. It does nothing unless the controller is running.
+func (c *Controller) Trigger() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.queue == nil {
+		return
+	}
+	objs, err := c.lister.List(labels.Everything())
+	if err != nil {
+		return
+	}
+	for _, obj := range objs {
+		if key, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+			c.queue.AddAfter(key, c.cfg.Debounce)
+		}
+	}
+}
+
+// Run reconciles the ExternalIPSets whenever one of them or the registry
+// changes, and every interval, until the context is done. Failed reconciles
+// are retried with exponential backoff unless retrying cannot fix them, they
+// never stop the controller.
+func (c *Controller) Run(ctx context.Context) error {
+	queue := workqueue.NewTypedRateLimitingQueueWithConfig(
+		reconciler.NewRateLimiter(c.cfg.RetryBaseDelay, c.cfg.RetryMaxDelay),
+		workqueue.TypedRateLimitingQueueConfig[string]{Name: "exips-externalipsets"},
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(c.dynamic, c.cfg.Interval)
+	defer func() {
+		cancel()
+		factory.Shutdown()
+	}()
+	informer := factory.ForResource(GroupVersionResource)
+	enqueue := func(obj any) {
+		if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+			queue.Add(key)
+		}
+	}
+	_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(_, newObj any) { // including the periodic resync
+			enqueue(newObj)
+		},
+		DeleteFunc: enqueue,
+	})
+	if err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return ctx.Err()
+	}
+
+	c.mu.Lock()
+	c.queue = queue
+	c.lister = informer.Lister()
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.queue = nil
+		c.lister = nil
+		c.mu.Unlock()
+	}()
+	go func() {
+		<-ctx.Done()
+		queue.ShutDown()
+	}()
+
+	// an empty registry would wipe all external IPs
+	if err := c.reg.WaitForSync(ctx); err != nil {
+		return err
+	}
+	for {
+		key, shutdown := queue.Get()
+		if shutdown {
+			return ctx.Err()
+		}
+		c.handleErr(ctx, queue, key, c.Reconcile(ctx, informer.Lister(), key))
+		queue.Done(key)
+	}
+}
+
+// handleErr retries the key if the reconcile failed and retrying can fix it.
+func (c *Controller) handleErr(ctx context.Context, queue workqueue.TypedRateLimitingInterface[string], key string, err error) {
+	switch {
+	case err == nil, ctx.Err() != nil:
+		queue.Forget(key)
+	case !reconciler.IsRetryable(err):
+		slog.Error("error reconciling ExternalIPSet", "err", err, "key", key)
+		queue.Forget(key)
+	case c.cfg.MaxRetries > 0 && queue.NumRequeues(key) >= c.cfg.MaxRetries:
+		slog.Error("error reconciling ExternalIPSet, giving up", "err", err, "key", key, "retries", c.cfg.MaxRetries)
+		queue.Forget(key)
+	default:
+		slog.Error("error reconciling ExternalIPSet, will retry", "err", err, "key", key, "retries", queue.NumRequeues(key))
+		queue.AddRateLimited(key)
+	}
+}
+
+// Reconcile publishes the IPs of the ExternalIPSet and updates its status.
+// Invalid specs, conflicts and targets the configuration does not allow are
+// reported in the status, but are no error.
+func (c *Controller) Reconcile(ctx context.Context, lister cache.GenericLister, key string) error {
+	if !c.reg.HasSynced() {
+		return reconciler.ErrNotSynced
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	obj, err := lister.ByNamespace(namespace).Get(name)
+	if apierrors.IsNotFound(err) { // the Service is garbage collected
+		c.forget(key)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("error: unexpected object %T", obj)
+	}
+	var set ExternalIPSet
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), &set); err != nil {
+		return c.updateStatus(ctx, u, &set, nil, nil, "", fmt.Errorf("%w: %w", errInvalidSpec, err))
+	}
+
+	t, err := c.target(&set)
+	if err != nil {
+		return c.updateStatus(ctx, u, &set, nil, nil, "", err)
+	}
+	if err := c.allowed(&t); err != nil {
+		// a Service published before is taken down
+		if previous := set.Status.ServiceName; previous != "" {
+			if err := c.deleteService(ctx, &set, previous); err != nil {
+				return err
+			}
+			c.forget(key)
+		}
+		return c.updateStatus(ctx, u, &set, nil, nil, "", err)
+	}
+	if publisher := c.conflicting(lister, &set, t.Name); publisher != "" {
+		return c.updateStatus(ctx, u, &set, nil, nil, "", fmt.Errorf("%w: Service %s is published by %s", errConflict, t.Name, publisher))
+	}
+	evaluations := c.reg.Evaluate(t.Eligibility)
+	ips, err := reconciler.Publish(ctx, c.client, t, evaluations)
+	if errors.Is(err, reconciler.ErrForeignService) {
+		return c.updateStatus(ctx, u, &set, evaluations, nil, "", fmt.Errorf("%w: Service %s exists and is not managed by exips", errConflict, t.Name))
+	}
+	if err == nil {
+		c.remember(key, t.Key())
+		// the status keeps the previous name until the Service is deleted
+		if previous := set.Status.ServiceName; previous != "" && previous != t.Name {
+			err = c.deleteService(ctx, &set, previous)
+		}
+	}
+	if statusErr := c.updateStatus(ctx, u, &set, evaluations, ips, t.Name, err); statusErr != nil {
+		return errors.Join(err, statusErr)
+	}
+	return err
+}
+
+// remember the Service the ExternalIPSet published, and forget the metrics
+// of the one it published before.
+func (c *Controller) remember(key, serviceKey string) {
+	c.mu.Lock()
+	previous, ok := c.published[key]
+	c.published[key] = serviceKey
+	c.mu.Unlock()
+
+	if ok && previous != serviceKey {
+		metrics.DeleteService(previous)
+	}
+}
+
+// forget the metrics of the Service of the deleted ExternalIPSet.
+func (c *Controller) forget(key string) {
+	c.mu.Lock()
+	serviceKey, ok := c.published[key]
+	delete(c.published, key)
+	c.mu.Unlock()
+
+	if ok {
+		metrics.DeleteService(serviceKey)
+	}
+}
+
+// deleteService deletes the Service the ExternalIPSet published under its
+// previous name, if the ExternalIPSet still owns it.
+func (c *Controller) deleteService(ctx context.Context, set *ExternalIPSet, name string) error {
+	svc, err := service.Get(ctx, c.client, name, set.Namespace)
+	if err != nil {
+		return err
+	}
+	if svc == nil || !slices.ContainsFunc(svc.OwnerReferences, func(ref metav1.OwnerReference) bool { return ref.UID == set.UID }) {
+		return nil
+	}
+	err = c.client.CoreV1().Services(set.Namespace).Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &svc.UID},
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error deleting Service %s/%s: %w", set.Namespace, name, err)
+	}
+	metrics.DeleteService(set.Namespace + "/" + name)
+	slog.Info("Service deleted", "name", name, "namespace", set.Namespace, "externalipset", set.Name)
+	return nil
+}
+
+// errNotAllowed is wrapped by errors of ExternalIPSets outside the configured
+// namespaces or with ports that are not allowed.
+var errNotAllowed = errors.New("not allowed")
+
+// allowed returns an error if the configuration does not allow the target of
+// an ExternalIPSet. Without endpoints, kube-proxy rejects traffic to the
+// ports of a Service on all published IPs, so a tenant must not pick them.
+func (c *Controller) allowed(t *reconciler.Target) error {
+	if len(c.cfg.Namespaces) > 0 && !slices.Contains(c.cfg.Namespaces, t.Namespace) {
+		return fmt.Errorf("%w: namespace %s", errNotAllowed, t.Namespace)
+	}
+	if len(c.cfg.Ports) == 0 {
+		return nil
+	}
+	ports := t.Ports
+	if len(ports) == 0 {
+		ports = service.DefaultPorts()
+	}
+	for _, p := range ports {
+		if !slices.Contains(c.cfg.Ports, p.Port) {
+			return fmt.Errorf("%w: port %d", errNotAllowed, p.Port)
+		}
+	}
+	return nil
+}
+
+// errConflict is wrapped by errors of ExternalIPSets declaring a Service that
+// a target of the configuration or an older ExternalIPSet publishes already,
+// or that exists without being managed by exips.
+var errConflict = errors.New("conflict")
+
+// conflicting returns what publishes the Service already, a target of the
+// configuration or an older ExternalIPSet in the same namespace, if any.
+func (c *Controller) conflicting(lister cache.GenericLister, set *ExternalIPSet, serviceName string) string {
+	for _, t := range c.cfg.Targets {
+		if t.Namespace == set.Namespace && t.Name == serviceName {
+			return "TARGETS"
+		}
+	}
+	objs, err := lister.ByNamespace(set.Namespace).List(labels.Everything())
+	if err != nil {
+		return ""
+	}
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || u.GetName() == set.Name {
+			continue
+		}
+		other, _, _ := unstructured.NestedString(u.Object, "spec", "serviceName")
+		if other == "" {
+			other = u.GetName()
+		}
+		if other != serviceName {
+			continue
+		}
+		created, otherCreated := set.CreationTimestamp, u.GetCreationTimestamp()
+		if otherCreated.Before(&created) || (otherCreated.Equal(&created) && u.GetName() < set.Name) {
+			return "ExternalIPSet " + u.GetName()
+		}
+	}
+	return ""
+}
+
+// target maps the ExternalIPSet to the target of its Service.
+func (c *Controller) target(set *ExternalIPSet) (reconciler.Target, error) {
+	rules := []node.Eligibility{c.cfg.Eligibility}
+	if set.Spec.NodeSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(set.Spec.NodeSelector)
+		if err != nil {
+			return reconciler.Target{}, fmt.Errorf("%w: nodeSelector: %w", errInvalidSpec, err)
+		}
+		if !selector.Empty() {
+			rules = append(rules, node.RequireLabels(selector))
+		}
+	}
+	if len(set.Spec.ExcludeNodes) > 0 {
+		selectors := make([]fields.Selector, len(set.Spec.ExcludeNodes))
+		for i, name := range set.Spec.ExcludeNodes {
+			selectors[i] = fields.OneTermNotEqualSelector("metadata.name", name)
+		}
+		rules = append(rules, node.RequireFields(fields.AndSelectors(selectors...)))
+	}
+	for _, taint := range set.Spec.ExcludeTaints {
+		rules = append(rules, node.ExcludeTaint(taint.Key, taint.Effect))
+	}
+	policy := node.DefaultFamilyPolicy
+	if set.Spec.IPFamilyPolicy != "" {
+		p, err := node.ParseFamilyPolicy(string(set.Spec.IPFamilyPolicy))
+		if err != nil {
+			return reconciler.Target{}, fmt.Errorf("%w: ipFamilyPolicy: %w", errInvalidSpec, err)
+		}
+		policy = p
+	}
+	for _, addrType := range set.Spec.AddressTypes {
+		if !slices.Contains(node.SupportedAddressTypes, addrType) {
+			return reconciler.Target{}, fmt.Errorf("%w: addressTypes: unsupported address type %q", errInvalidSpec, addrType)
+		}
+	}
+	switch set.Spec.ServiceType {
+	case "", corev1.ServiceTypeClusterIP, corev1.ServiceTypeLoadBalancer:
+	default:
+		return reconciler.Target{}, fmt.Errorf("%w: serviceType: unsupported type %q", errInvalidSpec, set.Spec.ServiceType)
+	}
+	switch set.Spec.Endpoints {
+	case "", service.EndpointAddressesInternal, service.EndpointAddressesPublic:
+	default:
+		return reconciler.Target{}, fmt.Errorf("%w: endpoints: unsupported addresses %q", errInvalidSpec, set.Spec.Endpoints)
+	}
+	name := set.Spec.ServiceName
+	if name == "" {
+		name = set.Name
+	}
+	yes := true
+	return reconciler.Target{
+		Name:         name,
+		Namespace:    set.Namespace,
+		Eligibility:  node.All(rules...),
+		FamilyPolicy: policy,
+		AddressTypes: set.Spec.AddressTypes,
+		StaticIPs:    c.cfg.StaticIPs,
+		Ports:        set.Spec.Ports,
+		Type:         set.Spec.ServiceType,
+		Endpoints:    set.Spec.Endpoints,
+		Owner: &metav1.OwnerReference{
+			APIVersion: Group + "/" + Version,
+			Kind:       Kind,
+			Name:       set.Name,
+			UID:        set.UID,
+			Controller: &yes,
+		},
+	}, nil
+}
+
+// updateStatus writes the outcome of the reconcile to the status, unless it
+// did not change. The IPs and the name of the Service are only written if
+// the reconcile succeeded, and cleared if it is not allowed. Errors of the
+// spec, conflicts and targets that are not allowed are not returned, since
+// retrying cannot fix them.
+func (c *Controller) updateStatus(ctx context.Context, u *unstructured.Unstructured, set *ExternalIPSet, evaluations []registry.Evaluation, ips []string, serviceName string, reconcileErr error) error {
+	status := set.Status
+	status.Conditions = slices.Clone(set.Status.Conditions)
+	status.ObservedGeneration = set.Generation
+	cond := metav1.Condition{
+		Type:               ConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: set.Generation,
+		Reason:             ReasonPublished,
+		Message:            fmt.Sprintf("%d IPs published", len(ips)),
+	}
+	switch {
+	case errors.Is(reconcileErr, errInvalidSpec):
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionFalse, ReasonInvalidSpec, reconcileErr.Error()
+	case errors.Is(reconcileErr, errConflict):
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionFalse, ReasonConflict, reconcileErr.Error()
+	case errors.Is(reconcileErr, errNotAllowed):
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionFalse, ReasonNotAllowed, reconcileErr.Error()
+		status.PublishedIPs, status.ServiceName = nil, ""
+	case reconcileErr != nil:
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionFalse, ReasonPublishFailed, reconcileErr.Error()
+	default:
+		status.PublishedIPs = ips
+		status.ServiceName = serviceName
+	}
+	if evaluations != nil {
+		status.EligibleNodes, status.ExcludedNodes, status.Nodes = 0, 0, nil
+		for _, e := range evaluations { // ordered by name
+			if e.Verdict.Eligible {
+				status.EligibleNodes++
+				continue
+			}
+			status.ExcludedNodes++
+			if len(status.Nodes) < MaxNodeStatuses {
+				status.Nodes = append(status.Nodes, NodeStatus{
+					Name:    e.Node.Name(),
+					Reason:  e.Verdict.Reason,
+					Message: e.Verdict.Message,
+				})
+			}
+		}
+	}
+	meta.SetStatusCondition(&status.Conditions, cond)
+	if equality.Semantic.DeepEqual(status, set.Status) {
+		return nil
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+	updated := u.DeepCopy()
+	if err := unstructured.SetNestedField(updated.Object, content, "status"); err != nil {
+		return err
+	}
+	if _, err := c.dynamic.Resource(GroupVersionResource).Namespace(set.Namespace).UpdateStatus(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("error updating status of ExternalIPSet %s/%s: %w", set.Namespace, set.Name, err)
+	}
+	if cond.Reason == ReasonInvalidSpec || cond.Reason == ReasonConflict || cond.Reason == ReasonNotAllowed {
+		slog.Warn("ExternalIPSet not published", "namespace", set.Namespace, "name", set.Name, "reason", cond.Reason, "message", cond.Message)
+	}
+	return nil
+}
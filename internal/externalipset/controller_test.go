@@ -0,0 +1,506 @@
+package externalipset
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fabiant7t/exips/internal/metrics"
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/node/nodetest"
+	"github.com/fabiant7t/exips/internal/node/registry"
+	"github.com/fabiant7t/exips/internal/reconciler"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func externalIPSet(t *testing.T, name string, created time.Time, spec Spec) *unstructured.Unstructured {
+	t.Helper()
+	set := &ExternalIPSet{
+		TypeMeta: metav1.TypeMeta{APIVersion: Group + "/" + Version, Kind: Kind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "ingress",
+			UID:               types.UID(name + "-uid"),
+			Generation:        1,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: spec,
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &unstructured.Unstructured{Object: content}
+}
+
+// waitForStatus polls the ExternalIPSet until its Ready condition has the
+// wanted reason, and returns its status.
+func waitForStatus(t *testing.T, ctx context.Context, client *dynamicfake.FakeDynamicClient, name, reason string) Status {
+	t.Helper()
+	var set ExternalIPSet
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		u, err := client.Resource(GroupVersionResource).Namespace("ingress").Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &set); err != nil {
+			t.Fatal(err)
+		}
+		if cond := meta.FindStatusCondition(set.Status.Conditions, ConditionReady); cond != nil && cond.Reason == reason {
+			return set.Status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s: Got status %+v, want reason %s", name, set.Status, reason)
+	return Status{}
+}
+
+func TestControllerPublishesExternalIPSets(t *testing.T) {
+	internalNode := func(name, ip string) *corev1.Node {
+		n := nodetest.Ready(name, ip)
+		n.Labels = map[string]string{"ingress": "internal"}
+		return n
+	}
+	client := fake.NewClientset(
+		nodetest.Ready("w-1", "1.2.3.4"),
+		internalNode("w-2", "2.3.4.5"),
+		internalNode("w-3", "3.4.5.6"),
+	)
+	now := time.Now()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{GroupVersionResource: Kind + "List"},
+		externalIPSet(t, "internal", now, Spec{
+			NodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"ingress": "internal"}},
+			ExcludeNodes: []string{"w-3"},
+			Ports:        []corev1.ServicePort{{Name: "https", Port: 443}},
+		}),
+		externalIPSet(t, "duplicate", now.Add(time.Second), Spec{ServiceName: "internal"}),
+		externalIPSet(t, "invalid", now, Spec{IPFamilyPolicy: "IPv5Only"}),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg := registry.New()
+	go reg.Run(ctx, client, 0)
+
+	ctrl := New(client, dynamicClient, reg, Config{
+		Eligibility: node.DefaultEligibility(),
+		Debounce:    10 * time.Millisecond,
+		Interval:    time.Hour,
+	})
+	go ctrl.Run(ctx)
+
+	status := waitForStatus(t, ctx, dynamicClient, "internal", ReasonPublished)
+	if got, want := status.PublishedIPs, []string{"2.3.4.5"}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	if got, want := status.ServiceName, "internal"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	if got, want := status.EligibleNodes, 1; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+	if got, want := status.ExcludedNodes, 2; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+	// only the excluded nodes are listed
+	if got, want := len(status.Nodes), 2; got != want {
+		t.Fatalf("Got %d, want %d", got, want)
+	}
+	if got, want := status.Nodes[0].Name+" "+status.Nodes[0].Reason, "w-1 "+node.ReasonLabelMismatch; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	if got, want := status.Nodes[1].Name+" "+status.Nodes[1].Reason, "w-3 "+node.ReasonFieldMismatch; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	svc, err := client.CoreV1().Services("ingress").Get(ctx, "internal", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := svc.Spec.ExternalIPs, []string{"2.3.4.5"}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	if got, want := svc.OwnerReferences[0].UID, types.UID("internal-uid"); got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+
+	waitForStatus(t, ctx, dynamicClient, "duplicate", ReasonConflict)
+	waitForStatus(t, ctx, dynamicClient, "invalid", ReasonInvalidSpec)
+	if _, err := client.CoreV1().Services("ingress").Get(ctx, "invalid", metav1.GetOptions{}); err == nil {
+		t.Error("Got Service of invalid ExternalIPSet, want none")
+	}
+
+	// node no longer matches
+	w2, err := client.CoreV1().Nodes().Get(ctx, "w-2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2.Labels = nil
+	if _, err := client.CoreV1().Nodes().Update(ctx, w2, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		status = waitForStatus(t, ctx, dynamicClient, "internal", ReasonPublished)
+		if len(status.PublishedIPs) == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Got %v, want no IPs", status.PublishedIPs)
+}
+
+func TestUpdateStatusCapsNodes(t *testing.T) {
+	u := externalIPSet(t, "web", time.Now(), Spec{})
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{GroupVersionResource: Kind + "List"}, u)
+	c := &Controller{dynamic: dynamicClient}
+	var evaluations []registry.Evaluation
+	for i := range MaxNodeStatuses + 5 {
+		n := node.NewDummyNode(fmt.Sprintf("w-%02d", i), true, true, true, nil)
+		evaluations = append(evaluations, registry.Evaluation{Node: n, Verdict: node.Verdict{Eligible: i == 0, Reason: node.ReasonCordoned}})
+	}
+	var set ExternalIPSet
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &set); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := c.updateStatus(ctx, u, &set, evaluations, nil, "web", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	status := waitForStatus(t, ctx, dynamicClient, "web", ReasonPublished)
+	if got, want := status.EligibleNodes, 1; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+	if got, want := status.ExcludedNodes, MaxNodeStatuses+4; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+	if got, want := len(status.Nodes), MaxNodeStatuses; got != want {
+		t.Fatalf("Got %d, want %d", got, want)
+	}
+	if got, want := status.Nodes[0].Name, "w-01"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+}
+
+func TestHandleErr(t *testing.T) {
+	c := &Controller{cfg: Config{MaxRetries: 2}}
+	queue := workqueue.NewTypedRateLimitingQueue(reconciler.NewRateLimiter(time.Millisecond, time.Millisecond))
+	defer queue.ShutDown()
+	ctx := context.Background()
+	transient := apierrors.NewServiceUnavailable("unavailable")
+
+	for i, want := range []int{1, 2, 0} { // gives up after MaxRetries
+		c.handleErr(ctx, queue, "ingress/set", transient)
+		if got := queue.NumRequeues("ingress/set"); got != want {
+			t.Errorf("%d: Got %d, want %d", i, got, want)
+		}
+	}
+
+	c.handleErr(ctx, queue, "ingress/set", transient)
+	c.handleErr(ctx, queue, "ingress/set", apierrors.NewForbidden(GroupVersionResource.GroupResource(), "set", nil))
+	if got, want := queue.NumRequeues("ingress/set"), 0; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+}
+
+func TestControllerReportsInvalidSpecs(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	now := time.Now()
+	specs := map[string]Spec{
+		"family-policy":  {IPFamilyPolicy: "IPv5Only"},
+		"node-selector":  {NodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"in valid": "true"}}},
+		"address-types":  {AddressTypes: []corev1.NodeAddressType{"PublicIP"}},
+		"service-type":   {ServiceType: corev1.ServiceTypeNodePort},
+		"endpoints-type": {Endpoints: "Everything"},
+	}
+	var objs []runtime.Object
+	for name, spec := range specs {
+		objs = append(objs, externalIPSet(t, name, now, spec))
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{GroupVersionResource: Kind + "List"}, objs...)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg := registry.New()
+	go reg.Run(ctx, client, 0)
+	go New(client, dynamicClient, reg, Config{Eligibility: node.DefaultEligibility(), Interval: time.Hour}).Run(ctx)
+
+	for name := range specs {
+		status := waitForStatus(t, ctx, dynamicClient, name, ReasonInvalidSpec)
+		if got := status.PublishedIPs; len(got) != 0 {
+			t.Errorf("%s: Got %v, want no IPs", name, got)
+		}
+		if _, err := client.CoreV1().Services("ingress").Get(ctx, name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+			t.Errorf("%s: Got %v, want no Service", name, err)
+		}
+	}
+}
+
+func TestControllerReportsConflicts(t *testing.T) {
+	client := fake.NewClientset(
+		nodetest.Ready("w-1", "1.2.3.4"),
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "foreign", Namespace: "ingress"},
+			Spec:       corev1.ServiceSpec{ExternalIPs: []string{"9.9.9.9"}},
+		},
+	)
+	now := time.Now()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{GroupVersionResource: Kind + "List"},
+		externalIPSet(t, "newer", now.Add(time.Second), Spec{ServiceName: "web"}),
+		externalIPSet(t, "older", now, Spec{ServiceName: "web"}),
+		externalIPSet(t, "foreign", now, Spec{}),
+		externalIPSet(t, "static", now, Spec{}),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg := registry.New()
+	go reg.Run(ctx, client, 0)
+	go New(client, dynamicClient, reg, Config{
+		Eligibility: node.DefaultEligibility(),
+		Targets:     []reconciler.Target{{Name: "static", Namespace: "ingress"}},
+		Interval:    time.Hour,
+	}).Run(ctx)
+
+	// the older ExternalIPSet wins
+	if got, want := waitForStatus(t, ctx, dynamicClient, "older", ReasonPublished).PublishedIPs, []string{"1.2.3.4"}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	waitForStatus(t, ctx, dynamicClient, "newer", ReasonConflict)
+	svc, err := client.CoreV1().Services("ingress").Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := svc.OwnerReferences[0].UID, types.UID("older-uid"); got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+
+	// a Service of another owner is left alone
+	waitForStatus(t, ctx, dynamicClient, "foreign", ReasonConflict)
+	svc, err = client.CoreV1().Services("ingress").Get(ctx, "foreign", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := svc.Spec.ExternalIPs, []string{"9.9.9.9"}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	if got := svc.OwnerReferences; len(got) != 0 {
+		t.Errorf("Got %v, want no owner", got)
+	}
+
+	// a Service of the configured targets is left to the reconciler
+	waitForStatus(t, ctx, dynamicClient, "static", ReasonConflict)
+	if _, err := client.CoreV1().Services("ingress").Get(ctx, "static", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Got %v, want no Service", err)
+	}
+}
+
+func TestControllerOwnsServices(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{GroupVersionResource: Kind + "List"},
+		externalIPSet(t, "web", time.Now(), Spec{}),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg := registry.New()
+	go reg.Run(ctx, client, 0)
+	go New(client, dynamicClient, reg, Config{Eligibility: node.DefaultEligibility(), Interval: time.Hour}).Run(ctx)
+
+	waitForStatus(t, ctx, dynamicClient, "web", ReasonPublished)
+	svc, err := client.CoreV1().Services("ingress").Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the garbage collector deletes the Service with its controller
+	if got, want := len(svc.OwnerReferences), 1; got != want {
+		t.Fatalf("Got %d, want %d", got, want)
+	}
+	ref := svc.OwnerReferences[0]
+	if got, want := ref.APIVersion, Group+"/"+Version; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	if got, want := ref.Kind, Kind; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	if got, want := ref.Name, "web"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	if got, want := ref.UID, types.UID("web-uid"); got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	if ref.Controller == nil || !*ref.Controller {
+		t.Errorf("Got %v, want controller reference", ref.Controller)
+	}
+}
+
+func TestControllerRenamesServices(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{GroupVersionResource: Kind + "List"},
+		externalIPSet(t, "web", time.Now(), Spec{ServiceName: "old"}),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg := registry.New()
+	go reg.Run(ctx, client, 0)
+	go New(client, dynamicClient, reg, Config{Eligibility: node.DefaultEligibility(), Interval: time.Hour}).Run(ctx)
+
+	if got, want := waitForStatus(t, ctx, dynamicClient, "web", ReasonPublished).ServiceName, "old"; got != want {
+		t.Fatalf("Got %s, want %s", got, want)
+	}
+	sets := dynamicClient.Resource(GroupVersionResource).Namespace("ingress")
+	u, err := sets.Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unstructured.SetNestedField(u.Object, "new", "spec", "serviceName"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sets.Update(ctx, u, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the Service under the previous name is deleted
+	deadline := time.Now().Add(5 * time.Second)
+	for waitForStatus(t, ctx, dynamicClient, "web", ReasonPublished).ServiceName != "new" {
+		if time.Now().After(deadline) {
+			t.Fatal("Got old Service name, want new")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := client.CoreV1().Services("ingress").Get(ctx, "new", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CoreV1().Services("ingress").Get(ctx, "old", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Got %v, want no Service", err)
+	}
+	if got, want := testutil.ToFloat64(metrics.PublishedExternalIPs.WithLabelValues("ingress/new")), 1.0; got != want {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	if metrics.PublishedExternalIPs.DeleteLabelValues("ingress/old") {
+		t.Error("Got metric of the old Service, want none")
+	}
+
+	// the metrics are deleted with the ExternalIPSet
+	published := testutil.CollectAndCount(metrics.PublishedExternalIPs)
+	if err := sets.Delete(ctx, "web", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline = time.Now().Add(5 * time.Second)
+	for testutil.CollectAndCount(metrics.PublishedExternalIPs) != published-1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Got metric of the deleted ExternalIPSet, want none")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	c := &Controller{cfg: Config{Namespaces: []string{"ingress"}, Ports: []int32{80, 443}}}
+	for _, tc := range []struct {
+		target reconciler.Target
+		err    bool
+	}{
+		{reconciler.Target{Namespace: "ingress", Ports: []corev1.ServicePort{{Port: 80}, {Port: 443}}}, false},
+		{reconciler.Target{Namespace: "tenant", Ports: []corev1.ServicePort{{Port: 443}}}, true},
+		{reconciler.Target{Namespace: "ingress", Ports: []corev1.ServicePort{{Port: 443}, {Port: 6443}}}, true},
+		{reconciler.Target{Namespace: "ingress"}, true}, // the default port
+	} {
+		if err := c.allowed(&tc.target); (err != nil) != tc.err {
+			t.Errorf("%s %v: Got %v, want error %t", tc.target.Namespace, tc.target.Ports, err, tc.err)
+		}
+	}
+	if err := (&Controller{}).allowed(&reconciler.Target{Namespace: "tenant"}); err != nil {
+		t.Errorf("Got %v, want no error", err)
+	}
+}
+
+func TestControllerTakesDownServicesThatAreNotAllowed(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{GroupVersionResource: Kind + "List"},
+		externalIPSet(t, "web", time.Now(), Spec{Ports: []corev1.ServicePort{{Name: "https", Port: 443}}}),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg := registry.New()
+	go reg.Run(ctx, client, 0)
+	go New(client, dynamicClient, reg, Config{
+		Eligibility: node.DefaultEligibility(),
+		Ports:       []int32{443},
+		Interval:    time.Hour,
+	}).Run(ctx)
+
+	waitForStatus(t, ctx, dynamicClient, "web", ReasonPublished)
+	sets := dynamicClient.Resource(GroupVersionResource).Namespace("ingress")
+	u, err := sets.Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := []any{map[string]any{"name": "kube-api", "port": int64(6443)}}
+	if err := unstructured.SetNestedSlice(u.Object, ports, "spec", "ports"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sets.Update(ctx, u, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	status := waitForStatus(t, ctx, dynamicClient, "web", ReasonNotAllowed)
+	if got := status.PublishedIPs; len(got) != 0 {
+		t.Errorf("Got %v, want no IPs", got)
+	}
+	if _, err := client.CoreV1().Services("ingress").Get(ctx, "web", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Got %v, want no Service", err)
+	}
+}
+
+func TestControllerPublishesStaticIPs(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{GroupVersionResource: Kind + "List"},
+		externalIPSet(t, "web", time.Now(), Spec{}),
+	)
+	staticIPs, err := registry.ParseStaticIPs("203.0.113.10,198.51.100.7@keepalived=master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg := registry.New()
+	go reg.Run(ctx, client, 0)
+	go New(client, dynamicClient, reg, Config{
+		Eligibility: node.DefaultEligibility(),
+		StaticIPs:   staticIPs,
+		Interval:    time.Hour,
+	}).Run(ctx)
+
+	// no eligible node holds the VIP
+	want := []string{"1.2.3.4", "203.0.113.10"}
+	if got := waitForStatus(t, ctx, dynamicClient, "web", ReasonPublished).PublishedIPs; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	svc, err := client.CoreV1().Services("ingress").Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := svc.Spec.ExternalIPs; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package externalipset
+
+import (
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/service"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group    = "exips.io"
+	Version  = "v1alpha1"
+	Kind     = "ExternalIPSet"
+	Resource = "externalipsets"
+)
+
+// GroupVersionResource of the ExternalIPSet CustomResourceDefinition.
+var GroupVersionResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: Resource}
+
+// Condition types and reasons of an ExternalIPSet.
+const (
+	ConditionReady = "Ready"
+
+	ReasonPublished     = "Published"
+	ReasonInvalidSpec   = "InvalidSpec"
+	ReasonConflict      = "Conflict"
+	ReasonNotAllowed    = "NotAllowed"
+	ReasonPublishFailed = "PublishFailed"
+)
+
+// ExternalIPSet declares a Service in its namespace that publishes the public
+// IPs of the eligible nodes.
+type ExternalIPSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   Spec   `json:"spec"`
+	Status Status `json:"status,omitempty"`
+}
+
+// Spec of an ExternalIPSet.
+type Spec struct {
+	// ServiceName is the name of the Service, the name of the ExternalIPSet
+	// if empty.
+	ServiceName string `json:"serviceName,omitempty"`
+	// NodeSelector restricts the nodes in addition to the global node
+	// eligibility.
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+	// IPFamilyPolicy decides which IP families of a node are published,
+	// node.DefaultFamilyPolicy if empty.
+	IPFamilyPolicy node.FamilyPolicy `json:"ipFamilyPolicy,omitempty"`
+	// AddressTypes decide which node addresses take precedence, the
+	// configured address types if empty.
+	AddressTypes []corev1.NodeAddressType `json:"addressTypes,omitempty"`
+	// ExcludeNodes are names of nodes that are never published.
+	ExcludeNodes []string `json:"excludeNodes,omitempty"`
+	// ExcludeTaints exclude nodes with a matching taint, an empty effect
+	// matches any effect.
+	ExcludeTaints []Taint `json:"excludeTaints,omitempty"`
+	// Ports of the Service, service.DefaultPorts if empty.
+	Ports []corev1.ServicePort `json:"ports,omitempty"`
+	// ServiceType ClusterIP (default) publishes the IPs as external IPs,
+	// LoadBalancer in the load balancer status.
+	ServiceType corev1.ServiceType `json:"serviceType,omitempty"`
+	// Endpoints decides which node addresses are listed in EndpointSlices
+	// of the Service, Internal or Public. No EndpointSlices if empty.
+	Endpoints service.EndpointAddresses `json:"endpoints,omitempty"`
+}
+
+// Taint matches node taints by key and effect.
+type Taint struct {
+	Key    string             `json:"key"`
+	Effect corev1.TaintEffect `json:"effect,omitempty"`
+}
+
+// MaxNodeStatuses caps the excluded nodes listed in the status, so it does
+// not grow with the cluster.
+const MaxNodeStatuses = 20
+
+// Status of an ExternalIPSet.
+type Status struct {
+	// ObservedGeneration is the generation of the spec the status is about.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ServiceName is the name of the Service the IPs were last published on.
+	ServiceName string `json:"serviceName,omitempty"`
+	// PublishedIPs are the external IPs of the Service.
+	PublishedIPs []string `json:"publishedIPs,omitempty"`
+	// EligibleNodes is the number of nodes whose IPs are published.
+	EligibleNodes int `json:"eligibleNodes,omitempty"`
+	// ExcludedNodes is the number of nodes whose IPs are not published.
+	ExcludedNodes int `json:"excludedNodes,omitempty"`
+	// Nodes are the verdicts of the first MaxNodeStatuses excluded nodes by
+	// name.
+	Nodes      []NodeStatus       `json:"nodes,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// NodeStatus is the verdict of an excluded node.
+type NodeStatus struct {
+	Name    string `json:"name"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,333 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/node/registry"
+	"github.com/fabiant7t/exips/internal/reconciler"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// GroupVersionResource of the Gateway API Gateways.
+var GroupVersionResource = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+
+// AddressTypeIPAddress is the Gateway address type of IPs, the default type
+// of requested addresses.
+const AddressTypeIPAddress = "IPAddress"
+
+// fieldManager of the status updates, which tells the Gateways exips wrote
+// IPs to.
+const fieldManager = "exips-gateway-status"
+
+// Config of the Controller.
+type Config struct {
+	// ClassName of the GatewayClass whose Gateways get the IPs
+	ClassName string
+	// SpecAddresses restricts the IPs to the ones requested in the
+	// spec.addresses of a Gateway, if it requests any
+	SpecAddresses bool
+	// Eligibility decides which nodes are published
+	Eligibility node.Eligibility
+	// FamilyPolicy decides which IP families of a node are published
+	FamilyPolicy node.FamilyPolicy
+	// Debounce is the delay between a change of the registry and the
+	// reconcile
+	Debounce time.Duration
+	// Interval of the safety resync
+	Interval time.Duration
+	// RetryBaseDelay is the delay before the first retry of a failed
+	// reconcile, doubling with every further retry up to RetryMaxDelay
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// MaxRetries of a failing reconcile before giving up on the Gateway
+	// until the next change or resync, 0 retries forever
+	MaxRetries int
+}
+
+// Controller writes the public IPs of the eligible nodes into the addresses
+// in the status of the Gateways of a GatewayClass.
+type Controller struct {
+	dynamic dynamic.Interface
+	reg     *registry.Registry
+	cfg     Config
+
+	mu     sync.Mutex
+	queue  workqueue.TypedRateLimitingInterface[string] // nil unless running
+	lister cache.GenericLister                          // nil unless running
+}
+
+// New creates a Controller for the Gateways of the configured class.
+func New(dynamicClient dynamic.Interface, reg *registry.Registry, cfg Config) *Controller {
+	c := &Controller{
+		dynamic: dynamicClient,
+		reg:     reg,
+		cfg:     cfg,
+	}
+	reg.Subscribe(c.Trigger)
+	return c
+}
+
+// Trigger schedules a reconcile of all Gateways after the debounce duration.
+// It does nothing unless the controller is running.
+func (c *Controller) Trigger() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.queue == nil {
+		return
+	}
+	objs, err := c.lister.List(labels.Everything())
+	if err != nil {
+		return
+	}
+	for _, obj := range objs {
+		if key, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+			c.queue.AddAfter(key, c.cfg.Debounce)
+		}
+	}
+}
+
+// Run reconciles the Gateways whenever one of them or the registry changes,
+// and every interval, until the context is done. Failed reconciles are
+// retried with exponential backoff unless retrying cannot fix them, they never
+// stop the controller.
+func (c *Controller) Run(ctx context.Context) error {
+	queue := workqueue.NewTypedRateLimitingQueueWithConfig(
+		reconciler.NewRateLimiter(c.cfg.RetryBaseDelay, c.cfg.RetryMaxDelay),
+		workqueue.TypedRateLimitingQueueConfig[string]{Name: "exips-gateways"},
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(c.dynamic, c.cfg.Interval)
+	defer func() {
+		cancel()
+		factory.Shutdown()
+	}()
+	informer := factory.ForResource(GroupVersionResource)
+	enqueue := func(obj any) {
+		if key, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+			queue.Add(key)
+		}
+	}
+	_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(_, newObj any) { // including the periodic resync
+			enqueue(newObj)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return ctx.Err()
+	}
+
+	c.mu.Lock()
+	c.queue = queue
+	c.lister = informer.Lister()
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.queue = nil
+		c.lister = nil
+		c.mu.Unlock()
+	}()
+	go func() {
+		<-ctx.Done()
+		queue.ShutDown()
+	}()
+
+	// an empty registry would wipe all addresses
+	if err := c.reg.WaitForSync(ctx); err != nil {
+		return err
+	}
+	for {
+		key, shutdown := queue.Get()
+		if shutdown {
+			return ctx.Err()
+		}
+		c.handleErr(ctx, queue, key, c.Reconcile(ctx, informer.Lister(), key))
+		queue.Done(key)
+	}
+}
+
+// handleErr retries the key if the reconcile failed and retrying can fix it.
+func (c *Controller) handleErr(ctx context.Context, queue workqueue.TypedRateLimitingInterface[string], key string, err error) {
+	switch {
+	case err == nil, ctx.Err() != nil:
+		queue.Forget(key)
+	case !reconciler.IsRetryable(err):
+		slog.Error("error reconciling Gateway", "err", err, "key", key)
+		queue.Forget(key)
+	case c.cfg.MaxRetries > 0 && queue.NumRequeues(key) >= c.cfg.MaxRetries:
+		slog.Error("error reconciling Gateway, giving up", "err", err, "key", key, "retries", c.cfg.MaxRetries)
+		queue.Forget(key)
+	default:
+		slog.Error("error reconciling Gateway, will retry", "err", err, "key", key, "retries", queue.NumRequeues(key))
+		queue.AddRateLimited(key)
+	}
+}
+
+// Reconcile sets the IP addresses in the status of the Gateway to the public
+// IPs of the eligible nodes if it is of the configured class, and removes the
+// IPs again if it no longer is.
+func (c *Controller) Reconcile(ctx context.Context, lister cache.GenericLister, key string) error {
+	if !c.reg.HasSynced() {
+		return reconciler.ErrNotSynced
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	obj, err := lister.ByNamespace(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("error: unexpected object %T", obj)
+	}
+
+	var ips []string
+	switch className, _, _ := unstructured.NestedString(u.Object, "spec", "gatewayClassName"); {
+	case className == c.cfg.ClassName:
+		available := c.reg.ParseExternalIPs(c.cfg.Eligibility, c.cfg.FamilyPolicy)
+		if requested := RequestedIPs(u); c.cfg.SpecAddresses && len(requested) > 0 {
+			var missing []netip.Addr
+			available, missing = filter(available, requested)
+			if len(missing) > 0 {
+				slog.Warn("requested Gateway addresses are no public IPs of eligible nodes", "name", name, "namespace", namespace, "ips", missing)
+			}
+		}
+		for _, ip := range available {
+			ips = append(ips, ip.String())
+		}
+	case managesStatus(u):
+		// clean up after a change of the class
+	default:
+		return nil
+	}
+	if slices.Equal(IPs(u), ips) {
+		slog.Debug("Gateway status is already up to date", "name", name, "namespace", namespace, "ips", ips)
+		return nil
+	}
+	if err := c.updateStatus(ctx, u, ips); err != nil {
+		return err
+	}
+	slog.Info("Gateway status updated", "name", name, "namespace", namespace, "ips", ips)
+	return nil
+}
+
+// filter returns the available IPs that are requested, and the requested IPs
+// that are not available.
+func filter(available, requested []netip.Addr) (found, missing []netip.Addr) {
+	for _, ip := range available {
+		if slices.Contains(requested, ip) {
+			found = append(found, ip)
+		}
+	}
+	for _, ip := range requested {
+		if !slices.Contains(available, ip) {
+			missing = append(missing, ip)
+		}
+	}
+	return found, missing
+}
+
+// RequestedIPs returns the IPs requested in the spec.addresses of the Gateway.
+// Addresses of other types and invalid IPs are ignored.
+func RequestedIPs(u *unstructured.Unstructured) []netip.Addr {
+	addresses, _, _ := unstructured.NestedSlice(u.Object, "spec", "addresses")
+	var ips []netip.Addr
+	for _, address := range addresses {
+		m, ok := address.(map[string]any)
+		if !ok {
+			continue
+		}
+		addrType, _, _ := unstructured.NestedString(m, "type")
+		if addrType != "" && addrType != AddressTypeIPAddress {
+			continue
+		}
+		value, _, _ := unstructured.NestedString(m, "value")
+		if ip, err := netip.ParseAddr(value); err == nil {
+			ips = append(ips, ip.Unmap())
+		}
+	}
+	return ips
+}
+
+// managesStatus returns true if exips owns fields of the Gateway, which are
+// only ever fields of its status.
+func managesStatus(u *unstructured.Unstructured) bool {
+	return slices.ContainsFunc(u.GetManagedFields(), func(entry metav1.ManagedFieldsEntry) bool {
+		return entry.Manager == fieldManager
+	})
+}
+
+// isIP returns true if the Gateway address is of type IPAddress, the default.
+func isIP(address map[string]any) bool {
+	addrType, _, _ := unstructured.NestedString(address, "type")
+	return addrType == "" || addrType == AddressTypeIPAddress
+}
+
+// IPs returns the IP addresses in the status of the Gateway.
+func IPs(u *unstructured.Unstructured) []string {
+	addresses, _, _ := unstructured.NestedSlice(u.Object, "status", "addresses")
+	var ips []string
+	for _, address := range addresses {
+		m, ok := address.(map[string]any)
+		if !ok {
+			continue
+		}
+		value, _, _ := unstructured.NestedString(m, "value")
+		if isIP(m) && value != "" {
+			ips = append(ips, value)
+		}
+	}
+	return ips
+}
+
+// updateStatus replaces the IP addresses in the status of the Gateway with
+// the IPs. Addresses of other types, like the Hostname of the Gateway
+// implementation, and the rest of the status are left alone.
+func (c *Controller) updateStatus(ctx context.Context, u *unstructured.Unstructured, ips []string) error {
+	updated := u.DeepCopy()
+	existing, _, _ := unstructured.NestedSlice(u.Object, "status", "addresses")
+	var addresses []any
+	for _, address := range existing {
+		if m, ok := address.(map[string]any); !ok || !isIP(m) {
+			addresses = append(addresses, address)
+		}
+	}
+	for _, ip := range ips {
+		addresses = append(addresses, map[string]any{"type": AddressTypeIPAddress, "value": ip})
+	}
+	if len(addresses) == 0 {
+		unstructured.RemoveNestedField(updated.Object, "status", "addresses")
+	} else if err := unstructured.SetNestedSlice(updated.Object, addresses, "status", "addresses"); err != nil {
+		return err
+	}
+	if _, err := c.dynamic.Resource(GroupVersionResource).Namespace(u.GetNamespace()).UpdateStatus(ctx, updated, metav1.UpdateOptions{FieldManager: fieldManager}); err != nil {
+		return fmt.Errorf("error updating status of Gateway %s/%s: %w", u.GetNamespace(), u.GetName(), err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package gateway
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/node/nodetest"
+	"github.com/fabiant7t/exips/internal/node/registry"
+	"github.com/fabiant7t/exips/internal/reconciler"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func gateway(name, className string, addresses ...map[string]any) *unstructured.Unstructured {
+	spec := map[string]any{"gatewayClassName": className}
+	if len(addresses) > 0 {
+		items := make([]any, len(addresses))
+		for i, address := range addresses {
+			items[i] = address
+		}
+		spec["addresses"] = items
+	}
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "Gateway",
+		"metadata":   map[string]any{"name": name, "namespace": "web"},
+		"spec":       spec,
+		"status": map[string]any{
+			"conditions": []any{map[string]any{"type": "Programmed", "status": "True"}},
+		},
+	}}
+}
+
+// waitForIPs polls the Gateway until its status has the wanted IPs.
+func waitForIPs(t *testing.T, client *dynamicfake.FakeDynamicClient, name string, want []string) *unstructured.Unstructured {
+	t.Helper()
+	var got []string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		u, err := client.Resource(GroupVersionResource).Namespace("web").Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = IPs(u)
+		if slices.Equal(got, want) {
+			return u
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s: Got %v, want %v", name, got, want)
+	return nil
+}
+
+func TestController(t *testing.T) {
+	client := fake.NewClientset(
+		nodetest.Ready("w-1", "1.2.3.4"),
+		nodetest.Ready("w-2", "2.3.4.5"),
+	)
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{GroupVersionResource: "GatewayList"},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// created by the client, the fake guesses the wrong resource otherwise
+	for _, gw := range []*unstructured.Unstructured{
+		gateway("traefik", "traefik"),
+		gateway("requested", "traefik",
+			map[string]any{"value": "2.3.4.5"},
+			map[string]any{"type": "IPAddress", "value": "9.9.9.9"},
+			map[string]any{"type": "Hostname", "value": "example.com"},
+		),
+		gateway("nginx", "nginx"),
+		withStatusAddresses(gateway("hostname", "traefik"), false, hostname),
+		withStatusAddresses(gateway("moved", "nginx"), true, ip("1.2.3.4"), hostname),
+		withStatusAddresses(gateway("foreign", "nginx"), false, ip("9.9.9.9")),
+	} {
+		if _, err := dynamicClient.Resource(GroupVersionResource).Namespace("web").Create(ctx, gw, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reg := registry.New()
+	go reg.Run(ctx, client, 0)
+	ctrl := New(dynamicClient, reg, Config{
+		ClassName:     "traefik",
+		SpecAddresses: true,
+		Eligibility:   node.DefaultEligibility(),
+		FamilyPolicy:  node.DefaultFamilyPolicy,
+		Debounce:      10 * time.Millisecond,
+		Interval:      time.Hour,
+	})
+	go ctrl.Run(ctx)
+
+	u := waitForIPs(t, dynamicClient, "traefik", []string{"1.2.3.4", "2.3.4.5"})
+	if conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions"); len(conditions) != 1 {
+		t.Errorf("Got %v, want the conditions of the Gateway implementation", conditions)
+	}
+	waitForIPs(t, dynamicClient, "requested", []string{"2.3.4.5"})
+
+	// addresses of the Gateway implementation are kept
+	u = waitForIPs(t, dynamicClient, "hostname", []string{"1.2.3.4", "2.3.4.5"})
+	if got := hostnames(u); !slices.Equal(got, []string{"gw.example.com"}) {
+		t.Errorf("Got %v, want the hostname of the Gateway implementation", got)
+	}
+
+	// class changed, stale IPs are removed, but only the ones of exips
+	u = waitForIPs(t, dynamicClient, "moved", nil)
+	if got := hostnames(u); !slices.Equal(got, []string{"gw.example.com"}) {
+		t.Errorf("Got %v, want the hostname of the Gateway implementation", got)
+	}
+
+	// node removed
+	if err := client.CoreV1().Nodes().Delete(ctx, "w-2", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForIPs(t, dynamicClient, "traefik", []string{"1.2.3.4"})
+	waitForIPs(t, dynamicClient, "requested", nil)
+	waitForIPs(t, dynamicClient, "nginx", nil)
+	waitForIPs(t, dynamicClient, "foreign", []string{"9.9.9.9"})
+}
+
+var hostname = map[string]any{"type": "Hostname", "value": "gw.example.com"}
+
+func ip(value string) map[string]any {
+	return map[string]any{"type": AddressTypeIPAddress, "value": value}
+}
+
+// withStatusAddresses sets the addresses of the status, as if exips wrote
+// them if managed.
+func withStatusAddresses(u *unstructured.Unstructured, managed bool, addresses ...map[string]any) *unstructured.Unstructured {
+	items := make([]any, len(addresses))
+	for i, address := range addresses {
+		items[i] = address
+	}
+	if managed {
+		u.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: fieldManager, Operation: metav1.ManagedFieldsOperationUpdate, Subresource: "status"}})
+	}
+	unstructured.SetNestedSlice(u.Object, items, "status", "addresses")
+	return u
+}
+
+// hostnames returns the Hostname addresses in the status of the Gateway.
+func hostnames(u *unstructured.Unstructured) []string {
+	addresses, _, _ := unstructured.NestedSlice(u.Object, "status", "addresses")
+	var names []string
+	for _, address := range addresses {
+		if m, ok := address.(map[string]any); ok && m["type"] == "Hostname" {
+			names = append(names, m["value"].(string))
+		}
+	}
+	return names
+}
+
+func TestHandleErr(t *testing.T) {
+	c := &Controller{cfg: Config{MaxRetries: 2}}
+	queue := workqueue.NewTypedRateLimitingQueue(reconciler.NewRateLimiter(time.Millisecond, time.Millisecond))
+	defer queue.ShutDown()
+	ctx := context.Background()
+	transient := apierrors.NewServiceUnavailable("unavailable")
+
+	for i, want := range []int{1, 2, 0} { // gives up after MaxRetries
+		c.handleErr(ctx, queue, "default/web", transient)
+		if got := queue.NumRequeues("default/web"); got != want {
+			t.Errorf("%d: Got %d, want %d", i, got, want)
+		}
+	}
+
+	c.handleErr(ctx, queue, "default/web", transient)
+	c.handleErr(ctx, queue, "default/web", apierrors.NewForbidden(GroupVersionResource.GroupResource(), "web", nil))
+	if got, want := queue.NumRequeues("default/web"), 0; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+}
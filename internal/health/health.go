@@ -0,0 +1,63 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Registry is the part of the node registry the probes look at.
+type Registry interface {
+	HasSynced() bool
+}
+
+// Reconciler is the part of the reconciler the probes look at.
+type Reconciler interface {
+	Running() bool
+	LastActive() time.Time
+	LastSuccess() time.Time
+}
+
+// Register adds the probes to the mux:
+//
+//   - /healthz succeeds while the process is alive.
+//   - /readyz succeeds once the registry has synced and, if this replica
+//     reconciles, the last successful reconcile is not older than maxAge.
+//   - /livez fails if this replica reconciles, but the reconcile loop made no
+//     progress within maxAge.
+func Register(mux *http.ServeMux, reg Registry, rec Reconciler, maxAge time.Duration) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		ok(w)
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if !reg.HasSynced() {
+			fail(w, "registry has not synced")
+			return
+		}
+		if rec.Running() {
+			if since := time.Since(rec.LastSuccess()); since > maxAge {
+				fail(w, fmt.Sprintf("last successful reconcile is older than %s", maxAge))
+				return
+			}
+		}
+		ok(w)
+	})
+	mux.HandleFunc("GET /livez", func(w http.ResponseWriter, _ *http.Request) {
+		if rec.Running() {
+			if since := time.Since(rec.LastActive()); since > maxAge {
+				fail(w, fmt.Sprintf("reconcile loop made no progress within %s", maxAge))
+				return
+			}
+		}
+		ok(w)
+	})
+}
+
+func ok(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+func fail(w http.ResponseWriter, reason string) {
+	http.Error(w, reason, http.StatusServiceUnavailable)
+}
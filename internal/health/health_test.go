@@ -0,0 +1,102 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type dummyRegistry struct {
+	hasSynced bool
+}
+
+func (r dummyRegistry) HasSynced() bool {
+	return r.hasSynced
+}
+
+type dummyReconciler struct {
+	running     bool
+	lastActive  time.Time
+	lastSuccess time.Time
+}
+
+func (r dummyReconciler) Running() bool {
+	return r.running
+}
+
+func (r dummyReconciler) LastActive() time.Time {
+	return r.lastActive
+}
+
+func (r dummyReconciler) LastSuccess() time.Time {
+	return r.lastSuccess
+}
+
+func TestProbes(t *testing.T) {
+	now := time.Now()
+	long := now.Add(-time.Hour)
+	for _, tc := range []struct {
+		name       string
+		reg        dummyRegistry
+		rec        dummyReconciler
+		wantHealth int
+		wantReady  int
+		wantLive   int
+	}{
+		{
+			name:       "registry not synced",
+			reg:        dummyRegistry{hasSynced: false},
+			rec:        dummyReconciler{running: true, lastActive: now},
+			wantHealth: http.StatusOK,
+			wantReady:  http.StatusServiceUnavailable,
+			wantLive:   http.StatusOK,
+		},
+		{
+			name:       "follower",
+			reg:        dummyRegistry{hasSynced: true},
+			rec:        dummyReconciler{running: false},
+			wantHealth: http.StatusOK,
+			wantReady:  http.StatusOK,
+			wantLive:   http.StatusOK,
+		},
+		{
+			name:       "leader reconciling successfully",
+			reg:        dummyRegistry{hasSynced: true},
+			rec:        dummyReconciler{running: true, lastActive: now, lastSuccess: now},
+			wantHealth: http.StatusOK,
+			wantReady:  http.StatusOK,
+			wantLive:   http.StatusOK,
+		},
+		{
+			name:       "leader failing to reconcile",
+			reg:        dummyRegistry{hasSynced: true},
+			rec:        dummyReconciler{running: true, lastActive: now, lastSuccess: long},
+			wantHealth: http.StatusOK,
+			wantReady:  http.StatusServiceUnavailable,
+			wantLive:   http.StatusOK,
+		},
+		{
+			name:       "leader stuck",
+			reg:        dummyRegistry{hasSynced: true},
+			rec:        dummyReconciler{running: true, lastActive: long, lastSuccess: long},
+			wantHealth: http.StatusOK,
+			wantReady:  http.StatusServiceUnavailable,
+			wantLive:   http.StatusServiceUnavailable,
+		},
+	} {
+		mux := http.NewServeMux()
+		Register(mux, tc.reg, tc.rec, time.Minute)
+		for path, want := range map[string]int{
+			"/healthz": tc.wantHealth,
+			"/readyz":  tc.wantReady,
+			"/livez":   tc.wantLive,
+		} {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+			if got := rr.Code; got != want {
+				t.Errorf("%s %s: Got %d, want %d", tc.name, path, got, want)
+			}
+		}
+	}
+}
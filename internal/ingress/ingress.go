@@ -0,0 +1,286 @@
+package ingress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/node/registry"
+	"github.com/fabiant7t/exips/internal/reconciler"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// fieldManager owns the load balancer status of the Ingresses, so it can be
+// removed again once an Ingress changes its class.
+const fieldManager = "exips-ingress-status"
+
+// annotationIngressClass is the deprecated way to set the class of an
+// Ingress, still honoured by most ingress controllers.
+const annotationIngressClass = "kubernetes.io/ingress.class"
+
+// Config of the Controller.
+type Config struct {
+	// ClassName of the IngressClass whose Ingresses get the IPs
+	ClassName string
+	// Eligibility decides which nodes are published
+	Eligibility node.Eligibility
+	// FamilyPolicy decides which IP families of a node are published
+	FamilyPolicy node.FamilyPolicy
+	// Debounce is the delay between a change of the registry and the
+	// reconcile
+	Debounce time.Duration
+	// Interval of the safety resync
+	Interval time.Duration
+	// RetryBaseDelay is the delay before the first retry of a failed
+	// reconcile, doubling with every further retry up to RetryMaxDelay
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// MaxRetries of a failing reconcile before giving up on the Ingress
+	// until the next change or resync, 0 retries forever
+	MaxRetries int
+}
+
+// Controller writes the public IPs of the eligible nodes into the load
+// balancer status of the Ingresses of an IngressClass.
+type Controller struct {
+	client kubernetes.Interface
+	reg    *registry.Registry
+	cfg    Config
+
+	mu     sync.Mutex
+	queue  workqueue.TypedRateLimitingInterface[string] // nil unless running
+	lister listersv1.IngressLister                      // nil unless running
+}
+
+// New creates a Controller for the Ingresses of the configured class.
+func New(client kubernetes.Interface, reg *registry.Registry, cfg Config) *Controller {
+	c := &Controller{
+		client: client,
+		reg:    reg,
+		cfg:    cfg,
+	}
+	reg.Subscribe(c.Trigger)
+	return c
+}
+
+// Trigger schedules a reconcile of all Ingresses after the debounce duration.
+// It does nothing unless the controller is running.
+func (c *Controller) Trigger() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.queue == nil {
+		return
+	}
+	ingresses, err := c.lister.List(labels.Everything())
+	if err != nil {
+		return
+	}
+	for _, ing := range ingresses {
+		c.queue.AddAfter(ing.Namespace+"/"+ing.Name, c.cfg.Debounce)
+	}
+}
+
+// Run reconciles the Ingresses whenever one of them or the registry changes,
+// and every interval, until the context is done. Failed reconciles are
+// retried with exponential backoff unless retrying cannot fix them, they never
+// stop the controller.
+func (c *Controller) Run(ctx context.Context) error {
+	queue := workqueue.NewTypedRateLimitingQueueWithConfig(
+		reconciler.NewRateLimiter(c.cfg.RetryBaseDelay, c.cfg.RetryMaxDelay),
+		workqueue.TypedRateLimitingQueueConfig[string]{Name: "exips-ingresses"},
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	factory := informers.NewSharedInformerFactory(c.client, c.cfg.Interval)
+	defer func() {
+		cancel()
+		factory.Shutdown()
+	}()
+	informer := factory.Networking().V1().Ingresses()
+	enqueue := func(obj any) {
+		if key, err := cache.MetaNamespaceKeyFunc(obj); err == nil {
+			queue.Add(key)
+		}
+	}
+	_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(_, newObj any) { // including the periodic resync
+			enqueue(newObj)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return ctx.Err()
+	}
+
+	c.mu.Lock()
+	c.queue = queue
+	c.lister = informer.Lister()
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.queue = nil
+		c.lister = nil
+		c.mu.Unlock()
+	}()
+	go func() {
+		<-ctx.Done()
+		queue.ShutDown()
+	}()
+
+	// an empty registry would wipe all IPs
+	if err := c.reg.WaitForSync(ctx); err != nil {
+		return err
+	}
+	for {
+		key, shutdown := queue.Get()
+		if shutdown {
+			return ctx.Err()
+		}
+		c.handleErr(ctx, queue, key, c.Reconcile(ctx, informer.Lister(), key))
+		queue.Done(key)
+	}
+}
+
+// handleErr retries the key if the reconcile failed and retrying can fix it.
+func (c *Controller) handleErr(ctx context.Context, queue workqueue.TypedRateLimitingInterface[string], key string, err error) {
+	switch {
+	case err == nil, ctx.Err() != nil:
+		queue.Forget(key)
+	case !reconciler.IsRetryable(err):
+		slog.Error("error reconciling Ingress", "err", err, "key", key)
+		queue.Forget(key)
+	case c.cfg.MaxRetries > 0 && queue.NumRequeues(key) >= c.cfg.MaxRetries:
+		slog.Error("error reconciling Ingress, giving up", "err", err, "key", key, "retries", c.cfg.MaxRetries)
+		queue.Forget(key)
+	default:
+		slog.Error("error reconciling Ingress, will retry", "err", err, "key", key, "retries", queue.NumRequeues(key))
+		queue.AddRateLimited(key)
+	}
+}
+
+// Reconcile sets the load balancer status of the Ingress to the public IPs of
+// the eligible nodes if it is of the configured class, and removes the IPs
+// again if it no longer is.
+func (c *Controller) Reconcile(ctx context.Context, lister listersv1.IngressLister, key string) error {
+	if !c.reg.HasSynced() {
+		return reconciler.ErrNotSynced
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	ing, err := lister.Ingresses(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var ips []string
+	switch {
+	case c.matches(ing):
+		for _, ip := range c.reg.ParseExternalIPs(c.cfg.Eligibility, c.cfg.FamilyPolicy) {
+			ips = append(ips, ip.String())
+		}
+	case managesStatus(ing):
+		// clean up after a change of the class
+	default:
+		return nil
+	}
+	if slices.Equal(IPs(ing), ips) {
+		slog.Debug("Ingress status is already up to date", "name", name, "namespace", namespace, "ips", ips)
+		return nil
+	}
+	if err := applyStatus(ctx, c.client, ing, ips); err != nil {
+		return err
+	}
+	slog.Info("Ingress status updated", "name", name, "namespace", namespace, "ips", ips)
+	return nil
+}
+
+// matches returns true if the Ingress is of the configured class.
+func (c *Controller) matches(ing *networkingv1.Ingress) bool {
+	if ing.Spec.IngressClassName != nil {
+		return *ing.Spec.IngressClassName == c.cfg.ClassName
+	}
+	return ing.Annotations[annotationIngressClass] == c.cfg.ClassName
+}
+
+// managesStatus returns true if exips owns fields of the Ingress, which are
+// only ever fields of its status.
+func managesStatus(ing *networkingv1.Ingress) bool {
+	return slices.ContainsFunc(ing.ManagedFields, func(entry metav1.ManagedFieldsEntry) bool {
+		return entry.Manager == fieldManager
+	})
+}
+
+// IPs returns the IPs of the load balancer status of the Ingress.
+func IPs(ing *networkingv1.Ingress) []string {
+	var ips []string
+	for _, ingress := range ing.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			ips = append(ips, ingress.IP)
+		}
+	}
+	return ips
+}
+
+// applyStatus sets the load balancer status of the Ingress to the IPs. An
+// empty list removes the IPs exips set before.
+func applyStatus(ctx context.Context, client kubernetes.Interface, ing *networkingv1.Ingress, ips []string) error {
+	status := networkingv1.IngressStatus{}
+	for _, ip := range ips {
+		status.LoadBalancer.Ingress = append(status.LoadBalancer.Ingress, networkingv1.IngressLoadBalancerIngress{IP: ip})
+	}
+	data, err := json.Marshal(&networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "networking.k8s.io/v1",
+			Kind:       "Ingress",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ing.Name,
+			Namespace: ing.Namespace,
+		},
+		Status: status,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling ingress status to JSON: %w ", err)
+	}
+
+	yes := true
+	_, err = client.NetworkingV1().Ingresses(ing.Namespace).Patch(
+		ctx,
+		ing.Name,
+		types.ApplyPatchType,
+		data,
+		metav1.PatchOptions{
+			FieldManager: fieldManager,
+			Force:        &yes,
+		},
+		"status",
+	)
+	if err != nil {
+		return fmt.Errorf("error patching ingress status: %w ", err)
+	}
+	return nil
+}
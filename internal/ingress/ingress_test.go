@@ -0,0 +1,156 @@
+package ingress
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/node/nodetest"
+	"github.com/fabiant7t/exips/internal/node/registry"
+	"github.com/fabiant7t/exips/internal/reconciler"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	listersv1 "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func ingress(name, className string, annotations map[string]string) *networkingv1.Ingress {
+	ing := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "web", Annotations: annotations},
+	}
+	if className != "" {
+		ing.Spec.IngressClassName = &className
+	}
+	return ing
+}
+
+// waitForIPs polls the Ingress until its status has the wanted IPs.
+func waitForIPs(t *testing.T, client kubernetes.Interface, name string, want []string) {
+	t.Helper()
+	var got []string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		ing, err := client.NetworkingV1().Ingresses("web").Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = IPs(ing)
+		if slices.Equal(got, want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s: Got %v, want %v", name, got, want)
+}
+
+func TestController(t *testing.T) {
+	client := fake.NewClientset(
+		nodetest.Ready("w-1", "1.2.3.4"),
+		ingress("traefik", "traefik", nil),
+		ingress("legacy", "", map[string]string{annotationIngressClass: "traefik"}),
+		ingress("nginx", "nginx", nil),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg := registry.New()
+	go reg.Run(ctx, client, 0)
+	ctrl := New(client, reg, Config{
+		ClassName:    "traefik",
+		Eligibility:  node.DefaultEligibility(),
+		FamilyPolicy: node.DefaultFamilyPolicy,
+		Debounce:     10 * time.Millisecond,
+		Interval:     time.Hour,
+	})
+	go ctrl.Run(ctx)
+
+	waitForIPs(t, client, "traefik", []string{"1.2.3.4"})
+	waitForIPs(t, client, "legacy", []string{"1.2.3.4"})
+
+	// new node
+	if _, err := client.CoreV1().Nodes().Create(ctx, nodetest.Ready("w-2", "2.3.4.5"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForIPs(t, client, "traefik", []string{"1.2.3.4", "2.3.4.5"})
+
+	// new Ingress
+	if _, err := client.NetworkingV1().Ingresses("web").Create(ctx, ingress("new", "traefik", nil), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForIPs(t, client, "new", []string{"1.2.3.4", "2.3.4.5"})
+
+	// class changed, stale IPs are removed
+	ing, err := client.NetworkingV1().Ingresses("web").Get(ctx, "traefik", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ing.Spec.IngressClassName = ptr("nginx")
+	if _, err := client.NetworkingV1().Ingresses("web").Update(ctx, ing, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForIPs(t, client, "traefik", nil)
+	waitForIPs(t, client, "nginx", nil)
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestHandleErr(t *testing.T) {
+	c := &Controller{cfg: Config{MaxRetries: 2}}
+	queue := workqueue.NewTypedRateLimitingQueue(reconciler.NewRateLimiter(time.Millisecond, time.Millisecond))
+	defer queue.ShutDown()
+	ctx := context.Background()
+	transient := apierrors.NewServiceUnavailable("unavailable")
+
+	for i, want := range []int{1, 2, 0} { // gives up after MaxRetries
+		c.handleErr(ctx, queue, "default/web", transient)
+		if got := queue.NumRequeues("default/web"); got != want {
+			t.Errorf("%d: Got %d, want %d", i, got, want)
+		}
+	}
+
+	c.handleErr(ctx, queue, "default/web", transient)
+	c.handleErr(ctx, queue, "default/web", apierrors.NewForbidden(networkingv1.Resource("ingresses"), "web", nil))
+	if got, want := queue.NumRequeues("default/web"), 0; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+}
+
+// failingLister fails every Get of an Ingress with err.
+type failingLister struct {
+	listersv1.IngressLister
+	err error
+}
+
+func (l failingLister) Ingresses(string) listersv1.IngressNamespaceLister { return l }
+
+func (l failingLister) Get(string) (*networkingv1.Ingress, error) { return nil, l.err }
+
+func TestReconcileListerErrors(t *testing.T) {
+	client := fake.NewClientset()
+	reg := registry.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reg.Run(ctx, client, 0)
+	if err := reg.WaitForSync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c := New(client, reg, Config{ClassName: "nginx"})
+
+	// a deleted Ingress is no error
+	notFound := apierrors.NewNotFound(networkingv1.Resource("ingresses"), "web")
+	if err := c.Reconcile(ctx, failingLister{err: notFound}, "web/web"); err != nil {
+		t.Errorf("Got %v, want no error", err)
+	}
+	unavailable := apierrors.NewServiceUnavailable("unavailable")
+	if err := c.Reconcile(ctx, failingLister{err: unavailable}, "web/web"); !errors.Is(err, unavailable) {
+		t.Errorf("Got %v, want %v", err, unavailable)
+	}
+}
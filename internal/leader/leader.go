@@ -0,0 +1,83 @@
+package leader
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Config of the Lease based leader election.
+type Config struct {
+	Namespace     string
+	Name          string
+	Identity      string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// Run campaigns for leadership until the context is done. While this
+// instance is the leader, run is called with a context that is cancelled
+// when the leadership is lost. Followers keep campaigning, so they take over
+// when the leader goes away. A lost leadership is only campaigned for again
+// once run returned, so two terms never run at the same time.
+func Run(ctx context.Context, client kubernetes.Interface, cfg Config, run func(ctx context.Context)) error {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: cfg.Namespace,
+			Name:      cfg.Name,
+		},
+		Client: client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: cfg.Identity,
+		},
+	}
+	var term sync.Mutex // held while run runs
+	lec := leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   cfg.LeaseDuration,
+		RenewDeadline:   cfg.RenewDeadline,
+		RetryPeriod:     cfg.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            cfg.Name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) { // in a goroutine
+				term.Lock()
+				defer term.Unlock()
+				if ctx.Err() != nil { // lost before the goroutine started
+					return
+				}
+				slog.Info("Started leading", "identity", cfg.Identity, "lease", cfg.Name, "namespace", cfg.Namespace)
+				run(ctx)
+			},
+			OnStoppedLeading: func() {
+				slog.Info("Stopped leading", "identity", cfg.Identity, "lease", cfg.Name, "namespace", cfg.Namespace)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != cfg.Identity {
+					slog.Info("New leader elected", "leader", identity, "lease", cfg.Name, "namespace", cfg.Namespace)
+				}
+			},
+		},
+	}
+
+	for { // Run returns whenever the leadership is lost
+		elector, err := leaderelection.NewLeaderElector(lec)
+		if err != nil {
+			return err
+		}
+		elector.Run(ctx)
+		// wait for the term to end, client-go does not
+		term.Lock()
+		term.Unlock()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRunWaitsForTheLostTerm(t *testing.T) {
+	client := fake.NewClientset()
+	cfg := Config{
+		Namespace:     "exips",
+		Name:          "exips",
+		Identity:      "exips-1",
+		LeaseDuration: 200 * time.Millisecond,
+		RenewDeadline: 100 * time.Millisecond,
+		RetryPeriod:   20 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// renewals fail while failing is set, so the leadership is lost
+	var failing atomic.Bool
+	client.PrependReactor("update", "leases", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if failing.Load() {
+			return true, nil, errors.New("unavailable")
+		}
+		return false, nil, nil
+	})
+	var terms, running, overlaps atomic.Int32
+	started := make(chan int32, 2)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Run(ctx, client, cfg, func(ctx context.Context) {
+			if running.Add(1) > 1 {
+				overlaps.Add(1)
+			}
+			defer running.Add(-1)
+			term := terms.Add(1)
+			started <- term
+			<-ctx.Done()
+			// the first term is slow to stop, while the lease could be
+			// acquired again
+			if term == 1 {
+				failing.Store(false)
+				time.Sleep(2 * cfg.LeaseDuration)
+			}
+		})
+	}()
+	waitForTerm := func(want int32) {
+		t.Helper()
+		select {
+		case got := <-started:
+			if got != want {
+				t.Fatalf("Got term %d, want %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Got no term %d", want)
+		}
+	}
+	waitForTerm(1)
+
+	failing.Store(true)
+	waitForTerm(2)
+	if got := overlaps.Load(); got != 0 {
+		t.Errorf("Got %d overlapping terms, want none", got)
+	}
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Errorf("Got %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "exips"
+
+var (
+	// PublishedExternalIPs is the number of external IPs published per Service.
+	PublishedExternalIPs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "published_external_ips",
+		Help:      "Number of external IPs published on the Service.",
+	}, []string{"service"})
+
+	// EligibleNodes is the number of nodes whose IPs are published per Service.
+	EligibleNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "eligible_nodes",
+		Help:      "Number of nodes eligible for publishing their IPs.",
+	}, []string{"service"})
+
+	// IneligibleNodes is the number of excluded nodes per Service and reason.
+	IneligibleNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ineligible_nodes",
+		Help:      "Number of nodes excluded from publishing their IPs, by reason.",
+	}, []string{"service", "reason"})
+
+	// ReconcileAttempts counts reconciles per Service.
+	ReconcileAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_attempts_total",
+		Help:      "Number of reconcile attempts.",
+	}, []string{"service"})
+
+	// ReconcileSuccesses counts successful reconciles per Service.
+	ReconcileSuccesses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_successes_total",
+		Help:      "Number of successful reconciles.",
+	}, []string{"service"})
+
+	// ReconcileFailures counts failed reconciles per Service.
+	ReconcileFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_failures_total",
+		Help:      "Number of failed reconciles.",
+	}, []string{"service"})
+
+	// LastSuccessfulReconcile is the time of the last successful reconcile
+	// per Service.
+	LastSuccessfulReconcile = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_reconcile_timestamp_seconds",
+		Help:      "Unix time of the last successful reconcile, the Service was up to date or got updated.",
+	}, []string{"service"})
+
+	// ServiceApplyDuration observes the latency of applying the Service.
+	ServiceApplyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "service_apply_duration_seconds",
+		Help:      "Latency of applying the Service.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "result"})
+
+	// LastSuccessfulApply is the time the Service was last applied successfully.
+	LastSuccessfulApply = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_apply_timestamp_seconds",
+		Help:      "Unix time the Service was last created or updated successfully.",
+	}, []string{"service"})
+
+	// SinkFailures counts failed publishes of the IPs to the sinks of a
+	// Service, e.g. DNS records.
+	SinkFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sink_failures_total",
+		Help:      "Number of failed publishes of the IPs to sinks like DNS records.",
+	}, []string{"service"})
+
+	// RegistryEvents counts informer events of the registry.
+	RegistryEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registry_events_total",
+		Help:      "Number of add, update and delete events of nodes and ingress controller pods.",
+	}, []string{"kind", "event"})
+)
+
+// Registry holds the exips metrics and the Go and process collectors.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		PublishedExternalIPs,
+		EligibleNodes,
+		IneligibleNodes,
+		ReconcileAttempts,
+		ReconcileSuccesses,
+		ReconcileFailures,
+		LastSuccessfulReconcile,
+		ServiceApplyDuration,
+		LastSuccessfulApply,
+		SinkFailures,
+		RegistryEvents,
+	)
+}
+
+// DeleteService deletes all series of the Service, once exips no longer
+// publishes it, so deleted Services do not pile up.
+func DeleteService(service string) {
+	labels := prometheus.Labels{"service": service}
+	for _, vec := range []interface{ DeletePartialMatch(prometheus.Labels) int }{
+		PublishedExternalIPs,
+		EligibleNodes,
+		IneligibleNodes,
+		ReconcileAttempts,
+		ReconcileSuccesses,
+		ReconcileFailures,
+		LastSuccessfulReconcile,
+		ServiceApplyDuration,
+		LastSuccessfulApply,
+		SinkFailures,
+	} {
+		vec.DeletePartialMatch(labels)
+	}
+}
+
+// Register adds the /metrics endpoint to the mux.
+func Register(mux *http.ServeMux) {
+	mux.Handle("GET /metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDeleteService(t *testing.T) {
+	for _, service := range []string{"exips/a", "exips/b"} {
+		PublishedExternalIPs.WithLabelValues(service).Set(2)
+		EligibleNodes.WithLabelValues(service).Set(2)
+		IneligibleNodes.WithLabelValues(service, "Cordoned").Set(1)
+		IneligibleNodes.WithLabelValues(service, "NotReady").Set(1)
+		ReconcileAttempts.WithLabelValues(service).Inc()
+		ReconcileSuccesses.WithLabelValues(service).Inc()
+		ReconcileFailures.WithLabelValues(service).Inc()
+		LastSuccessfulReconcile.WithLabelValues(service).SetToCurrentTime()
+		ServiceApplyDuration.WithLabelValues(service, "success").Observe(0.1)
+		ServiceApplyDuration.WithLabelValues(service, "failure").Observe(0.1)
+		LastSuccessfulApply.WithLabelValues(service).SetToCurrentTime()
+		SinkFailures.WithLabelValues(service).Inc()
+	}
+
+	DeleteService("exips/a")
+	for _, tc := range []struct {
+		name string
+		got  int
+		want int
+	}{
+		{"published", testutil.CollectAndCount(PublishedExternalIPs), 1},
+		{"eligible", testutil.CollectAndCount(EligibleNodes), 1},
+		{"ineligible", testutil.CollectAndCount(IneligibleNodes), 2},
+		{"attempts", testutil.CollectAndCount(ReconcileAttempts), 1},
+		{"successes", testutil.CollectAndCount(ReconcileSuccesses), 1},
+		{"failures", testutil.CollectAndCount(ReconcileFailures), 1},
+		{"last reconcile", testutil.CollectAndCount(LastSuccessfulReconcile), 1},
+		{"apply duration", testutil.CollectAndCount(ServiceApplyDuration), 2},
+		{"last apply", testutil.CollectAndCount(LastSuccessfulApply), 1},
+		{"sink failures", testutil.CollectAndCount(SinkFailures), 1},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s: Got %d, want %d", tc.name, tc.got, tc.want)
+		}
+	}
+	if got, want := testutil.ToFloat64(PublishedExternalIPs.WithLabelValues("exips/b")), 2.0; got != want {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
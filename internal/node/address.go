@@ -0,0 +1,157 @@
+package node
+
+import (
+	"fmt"
+	"net/netip"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Block is an address block of the IANA special-purpose address registries
+// (RFC 6890), or of the multicast address spaces.
+type Block struct {
+	Prefix netip.Prefix
+	Name   string
+	// Global is true if the addresses are globally reachable
+	Global bool
+}
+
+func (b Block) String() string {
+	return fmt.Sprintf("%s (%s)", b.Prefix, b.Name)
+}
+
+// SpecialPurposeBlocks are the blocks of the IANA IPv4 and IPv6
+// special-purpose address registries, plus multicast. Blocks the registries
+// do not mark as globally reachable (including N/A, like 6to4 and Teredo) are
+// not public. IPv4-mapped IPv6 addresses (::ffff:0:0/96) are classified as
+// the IPv4 address they map.
+var SpecialPurposeBlocks = []Block{
+	// IPv4
+	{netip.MustParsePrefix("0.0.0.0/8"), "This network", false},
+	{netip.MustParsePrefix("0.0.0.0/32"), "This host on this network", false},
+	{netip.MustParsePrefix("10.0.0.0/8"), "Private-Use", false},
+	{netip.MustParsePrefix("100.64.0.0/10"), "Shared Address Space", false},
+	{netip.MustParsePrefix("127.0.0.0/8"), "Loopback", false},
+	{netip.MustParsePrefix("169.254.0.0/16"), "Link Local", false},
+	{netip.MustParsePrefix("172.16.0.0/12"), "Private-Use", false},
+	{netip.MustParsePrefix("192.0.0.0/24"), "IETF Protocol Assignments", false},
+	{netip.MustParsePrefix("192.0.0.0/29"), "IPv4 Service Continuity Prefix", false},
+	{netip.MustParsePrefix("192.0.0.8/32"), "IPv4 dummy address", false},
+	{netip.MustParsePrefix("192.0.0.9/32"), "Port Control Protocol Anycast", true},
+	{netip.MustParsePrefix("192.0.0.10/32"), "Traversal Using Relays around NAT Anycast", true},
+	{netip.MustParsePrefix("192.0.0.170/32"), "NAT64/DNS64 Discovery", false},
+	{netip.MustParsePrefix("192.0.0.171/32"), "NAT64/DNS64 Discovery", false},
+	{netip.MustParsePrefix("192.0.2.0/24"), "Documentation (TEST-NET-1)", false},
+	{netip.MustParsePrefix("192.31.196.0/24"), "AS112-v4", true},
+	{netip.MustParsePrefix("192.52.193.0/24"), "AMT", true},
+	{netip.MustParsePrefix("192.88.99.0/24"), "Deprecated (6to4 Relay Anycast)", false},
+	{netip.MustParsePrefix("192.168.0.0/16"), "Private-Use", false},
+	{netip.MustParsePrefix("192.175.48.0/24"), "Direct Delegation AS112 Service", true},
+	{netip.MustParsePrefix("198.18.0.0/15"), "Benchmarking", false},
+	{netip.MustParsePrefix("198.51.100.0/24"), "Documentation (TEST-NET-2)", false},
+	{netip.MustParsePrefix("203.0.113.0/24"), "Documentation (TEST-NET-3)", false},
+	{netip.MustParsePrefix("224.0.0.0/4"), "Multicast", false},
+	{netip.MustParsePrefix("240.0.0.0/4"), "Reserved", false},
+	{netip.MustParsePrefix("255.255.255.255/32"), "Limited Broadcast", false},
+	// IPv6
+	{netip.MustParsePrefix("::1/128"), "Loopback Address", false},
+	{netip.MustParsePrefix("::/128"), "Unspecified Address", false},
+	{netip.MustParsePrefix("64:ff9b::/96"), "IPv4-IPv6 Translat.", true},
+	{netip.MustParsePrefix("64:ff9b:1::/48"), "IPv4-IPv6 Translat.", false},
+	{netip.MustParsePrefix("100::/64"), "Discard-Only Address Block", false},
+	{netip.MustParsePrefix("100:0:0:1::/64"), "Dummy IPv6 Prefix", false},
+	{netip.MustParsePrefix("2001::/23"), "IETF Protocol Assignments", false},
+	{netip.MustParsePrefix("2001::/32"), "TEREDO", false},
+	{netip.MustParsePrefix("2001:1::1/128"), "Port Control Protocol Anycast", true},
+	{netip.MustParsePrefix("2001:1::2/128"), "Traversal Using Relays around NAT Anycast", true},
+	{netip.MustParsePrefix("2001:1::3/128"), "DNS-SD Service Registration Protocol Anycast", true},
+	{netip.MustParsePrefix("2001:2::/48"), "Benchmarking", false},
+	{netip.MustParsePrefix("2001:3::/32"), "AMT", true},
+	{netip.MustParsePrefix("2001:4:112::/48"), "AS112-v6", true},
+	{netip.MustParsePrefix("2001:10::/28"), "Deprecated (previously ORCHID)", false},
+	{netip.MustParsePrefix("2001:20::/28"), "ORCHIDv2", true},
+	{netip.MustParsePrefix("2001:30::/28"), "Drone Remote ID Protocol Entity Tags (DETs) Prefix", true},
+	{netip.MustParsePrefix("2001:db8::/32"), "Documentation", false},
+	{netip.MustParsePrefix("2002::/16"), "6to4", false},
+	{netip.MustParsePrefix("2620:4f:8000::/48"), "Direct Delegation AS112 Service", true},
+	{netip.MustParsePrefix("3fff::/20"), "Documentation", false},
+	{netip.MustParsePrefix("5f00::/16"), "Segment Routing (SRv6) SIDs", false},
+	{netip.MustParsePrefix("fc00::/7"), "Unique-Local", false},
+	{netip.MustParsePrefix("fe80::/10"), "Link-Local Unicast", false},
+	{netip.MustParsePrefix("fec0::/10"), "Deprecated (Site-Local)", false},
+	{netip.MustParsePrefix("ff00::/8"), "Multicast", false},
+}
+
+// Classification of an IP.
+type Classification struct {
+	Public bool
+	// Block is the most specific special-purpose block the IP is in, the
+	// rule that rejected it if it is not public. Its prefix is invalid if the
+	// IP is in none.
+	Block Block
+}
+
+// Classify classifies the IP by the most specific special-purpose block it
+// is in. IPs outside of all blocks are public.
+func Classify(ip netip.Addr) Classification {
+	if !ip.IsValid() {
+		return Classification{}
+	}
+	ip = ip.Unmap()
+	var block Block
+	for _, b := range SpecialPurposeBlocks {
+		if b.Prefix.Contains(ip) && (!block.Prefix.IsValid() || b.Prefix.Bits() > block.Prefix.Bits()) {
+			block = b
+		}
+	}
+	if !block.Prefix.IsValid() {
+		return Classification{Public: true}
+	}
+	return Classification{Public: block.Global, Block: block}
+}
+
+// IsPublic returns true if the IP is globally reachable.
+func IsPublic(ip netip.Addr) bool {
+	return Classify(ip).Public
+}
+
+// AddressFilter decides which addresses of a node may be published.
+type AddressFilter struct {
+	// Allowed prefixes, addresses outside of them are never published. If
+	// empty, public addresses are. Allowed addresses are published even if
+	// they are not public, e.g. private addresses of internal-only clusters.
+	Allowed []netip.Prefix
+	// Denied prefixes are never published, even if allowed
+	Denied []netip.Prefix
+}
+
+// Accept returns true if the IP may be published, or false and the rule that
+// rejected it.
+func (f AddressFilter) Accept(ip netip.Addr) (bool, string) {
+	ip = ip.Unmap()
+	for _, p := range f.Denied {
+		if p.Contains(ip) {
+			return false, "denied by " + p.String()
+		}
+	}
+	if len(f.Allowed) > 0 {
+		for _, p := range f.Allowed {
+			if p.Contains(ip) {
+				return true, ""
+			}
+		}
+		return false, "not in allowed prefixes"
+	}
+	if c := Classify(ip); !c.Public {
+		return false, c.Block.String()
+	}
+	return true, ""
+}
+
+// RejectedIP is an IP of a node that is never published, and the rule that
+// rejected it.
+type RejectedIP struct {
+	IP   netip.Addr
+	Type corev1.NodeAddressType
+	Rule string
+}
@@ -0,0 +1,188 @@
+package node
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		ip     string
+		public bool
+		block  string // prefix of the block, empty if in none
+	}{
+		// IPv4
+		{"0.1.2.3", false, "0.0.0.0/8"},
+		{"0.0.0.0", false, "0.0.0.0/32"},
+		{"10.1.2.3", false, "10.0.0.0/8"},
+		{"100.64.0.1", false, "100.64.0.0/10"},
+		{"100.127.255.254", false, "100.64.0.0/10"},
+		{"127.0.0.1", false, "127.0.0.0/8"},
+		{"169.254.169.254", false, "169.254.0.0/16"},
+		{"172.31.0.1", false, "172.16.0.0/12"},
+		{"192.0.0.100", false, "192.0.0.0/24"},
+		{"192.0.0.1", false, "192.0.0.0/29"},
+		{"192.0.0.8", false, "192.0.0.8/32"},
+		{"192.0.0.9", true, "192.0.0.9/32"},
+		{"192.0.0.10", true, "192.0.0.10/32"},
+		{"192.0.0.170", false, "192.0.0.170/32"},
+		{"192.0.0.171", false, "192.0.0.171/32"},
+		{"192.0.2.1", false, "192.0.2.0/24"},
+		{"192.31.196.1", true, "192.31.196.0/24"},
+		{"192.52.193.1", true, "192.52.193.0/24"},
+		{"192.88.99.1", false, "192.88.99.0/24"},
+		{"192.168.0.1", false, "192.168.0.0/16"},
+		{"192.175.48.1", true, "192.175.48.0/24"},
+		{"198.19.255.1", false, "198.18.0.0/15"},
+		{"198.51.100.1", false, "198.51.100.0/24"},
+		{"203.0.113.1", false, "203.0.113.0/24"},
+		{"224.0.0.1", false, "224.0.0.0/4"},
+		{"239.255.255.250", false, "224.0.0.0/4"},
+		{"240.0.0.1", false, "240.0.0.0/4"},
+		{"255.255.255.255", false, "255.255.255.255/32"},
+		{"1.2.3.4", true, ""},
+		{"100.63.255.255", true, ""},
+		{"100.128.0.0", true, ""},
+		{"172.32.0.1", true, ""},
+		{"::ffff:10.1.2.3", false, "10.0.0.0/8"},
+		{"::ffff:1.2.3.4", true, ""},
+		// IPv6
+		{"::1", false, "::1/128"},
+		{"::", false, "::/128"},
+		{"64:ff9b::102:304", true, "64:ff9b::/96"},
+		{"64:ff9b:1::1", false, "64:ff9b:1::/48"},
+		{"100::1", false, "100::/64"},
+		{"100:0:0:1::1", false, "100:0:0:1::/64"},
+		{"2001:100::1", false, "2001::/23"},
+		{"2001::1", false, "2001::/32"},
+		{"2001:1::1", true, "2001:1::1/128"},
+		{"2001:1::2", true, "2001:1::2/128"},
+		{"2001:1::3", true, "2001:1::3/128"},
+		{"2001:2::1", false, "2001:2::/48"},
+		{"2001:3::1", true, "2001:3::/32"},
+		{"2001:4:112::1", true, "2001:4:112::/48"},
+		{"2001:10::1", false, "2001:10::/28"},
+		{"2001:20::1", true, "2001:20::/28"},
+		{"2001:30::1", true, "2001:30::/28"},
+		{"2001:db8::1", false, "2001:db8::/32"},
+		{"2002:102:304::1", false, "2002::/16"},
+		{"2620:4f:8000::1", true, "2620:4f:8000::/48"},
+		{"3fff::1", false, "3fff::/20"},
+		{"5f00::1", false, "5f00::/16"},
+		{"fd00::1", false, "fc00::/7"},
+		{"fe80::1", false, "fe80::/10"},
+		{"fec0::1", false, "fec0::/10"},
+		{"ff02::1", false, "ff00::/8"},
+		{"2a01:4f8::1", true, ""},
+		{"2001:200::1", true, ""},
+	}
+	covered := map[netip.Prefix]bool{}
+	for _, tc := range cases {
+		c := Classify(netip.MustParseAddr(tc.ip))
+		if got, want := c.Public, tc.public; got != want {
+			t.Errorf("%s: Got %t, want %t", tc.ip, got, want)
+		}
+		got := ""
+		if c.Block.Prefix.IsValid() {
+			got = c.Block.Prefix.String()
+			covered[c.Block.Prefix] = true
+		}
+		if want := tc.block; got != want {
+			t.Errorf("%s: Got %s, want %s", tc.ip, got, want)
+		}
+	}
+	for _, b := range SpecialPurposeBlocks {
+		if !covered[b.Prefix] {
+			t.Errorf("Got no case for %s", b)
+		}
+	}
+}
+
+func TestClassifyInvalid(t *testing.T) {
+	if IsPublic(netip.Addr{}) {
+		t.Errorf("Got public, want not public")
+	}
+}
+
+func TestPublicIPsSkipsSpecialPurpose(t *testing.T) {
+	external := func(ips ...string) *corev1.Node {
+		n := &corev1.Node{}
+		for _, ip := range ips {
+			n.Status.Addresses = append(n.Status.Addresses, corev1.NodeAddress{Address: ip, Type: corev1.NodeExternalIP})
+		}
+		return n
+	}
+	n := New(external("100.64.0.1", "192.0.2.1", "fd00::1", "2001:db8::1", "1.2.3.4", "2a01:4f8::1"))
+	if got, want := n.PublicIPs(), []netip.Addr{netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2a01:4f8::1")}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	if _, err := New(external("100.64.0.1")).PublicIP(); err != ErrNoPublicIP {
+		t.Errorf("Got %v, want %v", err, ErrNoPublicIP)
+	}
+}
+
+func TestAddressFilter(t *testing.T) {
+	f := AddressFilter{
+		Allowed: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2a01:4f8::/32")},
+		Denied:  []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")},
+	}
+	for _, tc := range []struct {
+		filter AddressFilter
+		ip     string
+		want   bool
+		rule   string
+	}{
+		{f, "10.1.2.3", true, ""},
+		{f, "::ffff:10.1.2.3", true, ""},
+		{f, "10.0.0.1", false, "denied by 10.0.0.0/24"},
+		{f, "2a01:4f8::1", true, ""},
+		{f, "1.2.3.4", false, "not in allowed prefixes"},
+		{AddressFilter{}, "1.2.3.4", true, ""},
+		{AddressFilter{}, "10.1.2.3", false, "10.0.0.0/8 (Private-Use)"},
+		{AddressFilter{Denied: f.Denied}, "10.0.0.1", false, "denied by 10.0.0.0/24"},
+	} {
+		ok, rule := tc.filter.Accept(netip.MustParseAddr(tc.ip))
+		if got, want := ok, tc.want; got != want {
+			t.Errorf("%s: Got %t, want %t", tc.ip, got, want)
+		}
+		if got, want := rule, tc.rule; got != want {
+			t.Errorf("%s: Got %s, want %s", tc.ip, got, want)
+		}
+	}
+}
+
+func TestPublicIPsWithAddressFilter(t *testing.T) {
+	n := New(&corev1.Node{Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+		{Address: "1.2.3.4", Type: corev1.NodeExternalIP},
+		{Address: "192.168.0.2", Type: corev1.NodeInternalIP},
+		{Address: "10.0.0.2", Type: corev1.NodeInternalIP},
+	}}}).WithAddressFilter(AddressFilter{
+		Allowed: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.0.0/16")},
+		Denied:  []netip.Prefix{netip.MustParsePrefix("192.168.0.0/24")},
+	})
+	if got, want := n.PublicIPs(), []netip.Addr{netip.MustParseAddr("10.0.0.2")}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	if got, err := n.PublicIP(); err != nil || got != netip.MustParseAddr("10.0.0.2") {
+		t.Errorf("Got %v (%v), want 10.0.0.2", got, err)
+	}
+}
+
+func TestRejectedIPs(t *testing.T) {
+	n := New(&corev1.Node{Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+		{Address: "192.168.0.2", Type: corev1.NodeInternalIP},
+		{Address: "1.2.3.4", Type: corev1.NodeExternalIP},
+		{Address: "198.51.100.7", Type: corev1.NodeExternalIP},
+	}}}).WithAddressFilter(AddressFilter{Denied: []netip.Prefix{netip.MustParsePrefix("1.2.3.0/24")}})
+	want := []RejectedIP{
+		{IP: netip.MustParseAddr("1.2.3.4"), Type: corev1.NodeExternalIP, Rule: "denied by 1.2.3.0/24"},
+		{IP: netip.MustParseAddr("198.51.100.7"), Type: corev1.NodeExternalIP, Rule: "198.51.100.0/24 (Documentation (TEST-NET-2))"},
+		{IP: netip.MustParseAddr("192.168.0.2"), Type: corev1.NodeInternalIP, Rule: "192.168.0.0/16 (Private-Use)"},
+	}
+	if got := n.RejectedIPs(); !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
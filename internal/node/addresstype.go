@@ -0,0 +1,80 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultAddressTypes is the precedence of node address types when selecting
+// the public IPs: external IPs take precedence over internal IPs.
+var DefaultAddressTypes = []corev1.NodeAddressType{corev1.NodeExternalIP, corev1.NodeInternalIP}
+
+// SupportedAddressTypes are the node address types IPs can be selected from.
+var SupportedAddressTypes = []corev1.NodeAddressType{
+	corev1.NodeExternalIP,
+	corev1.NodeInternalIP,
+	corev1.NodeHostName,
+	corev1.NodeExternalDNS,
+	corev1.NodeInternalDNS,
+}
+
+// ResolveTimeout limits the resolution of a name.
+const ResolveTimeout = 2 * time.Second
+
+// Resolver resolves the names of Hostname, ExternalDNS and InternalDNS
+// addresses. *net.Resolver satisfies it.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// Resolve returns the IPs of the name, sorted so the choice among them is
+// stable. The lookup is limited to ResolveTimeout.
+func Resolve(ctx context.Context, r Resolver, name string) ([]netip.Addr, error) {
+	ctx, cancel := context.WithTimeout(ctx, ResolveTimeout)
+	defer cancel()
+	ips, err := r.LookupNetIP(ctx, "ip", name)
+	if err != nil {
+		return nil, err
+	}
+	for i, ip := range ips {
+		ips[i] = ip.Unmap()
+	}
+	slices.SortFunc(ips, netip.Addr.Compare)
+	return ips, nil
+}
+
+// IsNameAddressType returns true if addresses of the type are names, not IPs.
+func IsNameAddressType(addrType corev1.NodeAddressType) bool {
+	switch addrType {
+	case corev1.NodeHostName, corev1.NodeExternalDNS, corev1.NodeInternalDNS:
+		return true
+	}
+	return false
+}
+
+// ParseAddressTypes parses a comma separated list of node address types in
+// order of precedence, e.g. ExternalIP,ExternalDNS,InternalIP.
+func ParseAddressTypes(s string) ([]corev1.NodeAddressType, error) {
+	var addressTypes []corev1.NodeAddressType
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		addrType := corev1.NodeAddressType(item)
+		if !slices.Contains(SupportedAddressTypes, addrType) {
+			return nil, fmt.Errorf("invalid address type %q", item)
+		}
+		if slices.Contains(addressTypes, addrType) {
+			return nil, fmt.Errorf("duplicate address type %q", item)
+		}
+		addressTypes = append(addressTypes, addrType)
+	}
+	return addressTypes, nil
+}
@@ -0,0 +1,23 @@
+package node
+
+import (
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseAddressTypes(t *testing.T) {
+	got, err := ParseAddressTypes("ExternalIP, ExternalDNS,Hostname,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []corev1.NodeAddressType{corev1.NodeExternalIP, corev1.NodeExternalDNS, corev1.NodeHostName}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	for _, s := range []string{"PublicIP", "ExternalIP,ExternalIP"} {
+		if _, err := ParseAddressTypes(s); err == nil {
+			t.Errorf("%s: Got no error, want error", s)
+		}
+	}
+}
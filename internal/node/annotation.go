@@ -0,0 +1,110 @@
+package node
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+)
+
+// Annotations overriding what exips derives from the status of a node.
+const (
+	// AnnotationPublicIPv4 is the public IPv4 address of the node, e.g. the
+	// address it is reachable at through 1:1 NAT or a floating IP.
+	AnnotationPublicIPv4 = "exips.io/public-ipv4"
+	// AnnotationPublicIPv6 is the public IPv6 address of the node.
+	AnnotationPublicIPv6 = "exips.io/public-ipv6"
+	// AnnotationExclude excludes the node if true.
+	AnnotationExclude = "exips.io/exclude"
+)
+
+// Overrides of a node, set by its annotations.
+type Overrides struct {
+	// PublicIPv4 and PublicIPv6 take precedence over the addresses of the
+	// node status, invalid if not overridden
+	PublicIPv4 netip.Addr
+	PublicIPv6 netip.Addr
+	// Exclude the node
+	Exclude bool
+}
+
+// ParseOverrides parses the annotations of a node. Invalid annotations are
+// ignored and reported as errors.
+func ParseOverrides(annotations map[string]string) (Overrides, []error) {
+	var o Overrides
+	var errs []error
+	if v, ok := annotations[AnnotationPublicIPv4]; ok {
+		ip, err := netip.ParseAddr(v)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("invalid annotation %s: %w", AnnotationPublicIPv4, err))
+		case !ip.Unmap().Is4():
+			errs = append(errs, fmt.Errorf("invalid annotation %s: %s is not an IPv4 address", AnnotationPublicIPv4, v))
+		default:
+			o.PublicIPv4 = ip.Unmap()
+		}
+	}
+	if v, ok := annotations[AnnotationPublicIPv6]; ok {
+		ip, err := netip.ParseAddr(v)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("invalid annotation %s: %w", AnnotationPublicIPv6, err))
+		case !ip.Is6() || ip.Is4In6():
+			errs = append(errs, fmt.Errorf("invalid annotation %s: %s is not an IPv6 address", AnnotationPublicIPv6, v))
+		case ip.Zone() != "": // only meaningful on the node itself
+			errs = append(errs, fmt.Errorf("invalid annotation %s: %s has a zone", AnnotationPublicIPv6, v))
+		default:
+			o.PublicIPv6 = ip
+		}
+	}
+	if v, ok := annotations[AnnotationExclude]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid annotation %s: %q is not a boolean", AnnotationExclude, v))
+		} else {
+			o.Exclude = b
+		}
+	}
+	return o, errs
+}
+
+// Filter returns the overrides without the IPs the address filter rejects,
+// and an error for each of them.
+func (o Overrides) Filter(f AddressFilter) (Overrides, []error) {
+	var errs []error
+	for _, override := range []struct {
+		annotation string
+		ip         *netip.Addr
+	}{
+		{AnnotationPublicIPv4, &o.PublicIPv4},
+		{AnnotationPublicIPv6, &o.PublicIPv6},
+	} {
+		if !override.ip.IsValid() {
+			continue
+		}
+		if ok, rule := f.Accept(*override.ip); !ok {
+			errs = append(errs, fmt.Errorf("invalid annotation %s: %s is rejected: %s", override.annotation, *override.ip, rule))
+			*override.ip = netip.Addr{}
+		}
+	}
+	return o, errs
+}
+
+// apply replaces the IPs of the overridden families, IPv4 first.
+func (o Overrides) apply(ips []netip.Addr) []netip.Addr {
+	ipv4, ipv6 := o.PublicIPv4, o.PublicIPv6
+	for _, ip := range ips {
+		if ip.Is4() && !ipv4.IsValid() {
+			ipv4 = ip
+		}
+		if ip.Is6() && !ipv6.IsValid() {
+			ipv6 = ip
+		}
+	}
+	result := make([]netip.Addr, 0, 2)
+	for _, ip := range []netip.Addr{ipv4, ipv6} {
+		if ip.IsValid() {
+			result = append(result, ip)
+		}
+	}
+	return result
+}
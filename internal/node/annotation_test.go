@@ -0,0 +1,108 @@
+package node
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseOverrides(t *testing.T) {
+	for _, tc := range []struct {
+		annotations map[string]string
+		want        Overrides
+		errs        int
+	}{
+		{nil, Overrides{}, 0},
+		{
+			map[string]string{AnnotationPublicIPv4: "1.2.3.4", AnnotationPublicIPv6: "2a01:4f8::1", AnnotationExclude: "false"},
+			Overrides{PublicIPv4: netip.MustParseAddr("1.2.3.4"), PublicIPv6: netip.MustParseAddr("2a01:4f8::1")},
+			0,
+		},
+		{map[string]string{AnnotationPublicIPv4: "::ffff:1.2.3.4"}, Overrides{PublicIPv4: netip.MustParseAddr("1.2.3.4")}, 0},
+		{map[string]string{AnnotationExclude: "true"}, Overrides{Exclude: true}, 0},
+		{map[string]string{AnnotationPublicIPv4: "2a01:4f8::1"}, Overrides{}, 1},
+		{map[string]string{AnnotationPublicIPv6: "1.2.3.4"}, Overrides{}, 1},
+		{map[string]string{AnnotationPublicIPv6: "::ffff:1.2.3.4"}, Overrides{}, 1},
+		{map[string]string{AnnotationPublicIPv6: "fe80::1%eth0"}, Overrides{}, 1},
+		{
+			map[string]string{AnnotationPublicIPv4: "1.2.3", AnnotationPublicIPv6: "2a01:4f8::1", AnnotationExclude: "maybe"},
+			Overrides{PublicIPv6: netip.MustParseAddr("2a01:4f8::1")},
+			2,
+		},
+	} {
+		got, errs := ParseOverrides(tc.annotations)
+		if want := tc.want; got != want {
+			t.Errorf("%v: Got %+v, want %+v", tc.annotations, got, want)
+		}
+		if got, want := len(errs), tc.errs; got != want {
+			t.Errorf("%v: Got %d errors (%v), want %d", tc.annotations, got, errs, want)
+		}
+	}
+}
+
+func TestNodeOverrides(t *testing.T) {
+	status := corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+		{Address: "1.2.3.4", Type: corev1.NodeExternalIP},
+		{Address: "2a01:4f8::1", Type: corev1.NodeExternalIP},
+	}}
+	for _, tc := range []struct {
+		annotations map[string]string
+		want        []netip.Addr
+	}{
+		{nil, []netip.Addr{netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2a01:4f8::1")}},
+		{
+			map[string]string{AnnotationPublicIPv4: "5.6.7.8"},
+			[]netip.Addr{netip.MustParseAddr("5.6.7.8"), netip.MustParseAddr("2a01:4f8::1")},
+		},
+		{
+			map[string]string{AnnotationPublicIPv4: "5.6.7.8", AnnotationPublicIPv6: "2a01:4f8::2"},
+			[]netip.Addr{netip.MustParseAddr("5.6.7.8"), netip.MustParseAddr("2a01:4f8::2")},
+		},
+		{
+			map[string]string{AnnotationPublicIPv4: "invalid"},
+			[]netip.Addr{netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2a01:4f8::1")},
+		},
+		{
+			map[string]string{AnnotationPublicIPv4: "10.0.0.1", AnnotationPublicIPv6: "fd00::1"},
+			[]netip.Addr{netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2a01:4f8::1")},
+		},
+	} {
+		n := New(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}, Status: status})
+		if got, want := n.PublicIPs(), tc.want; !slices.Equal(got, want) {
+			t.Errorf("%v: Got %v, want %v", tc.annotations, got, want)
+		}
+		if got, err := n.PublicIP(); err != nil || got != tc.want[0] {
+			t.Errorf("%v: Got %v (%v), want %v", tc.annotations, got, err, tc.want[0])
+		}
+	}
+
+	// overrides apply to nodes without public addresses
+	n := New(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationPublicIPv6: "2a01:4f8::2"}}})
+	if got, want := n.PublicIPs(), []netip.Addr{netip.MustParseAddr("2a01:4f8::2")}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func TestOverridesFilter(t *testing.T) {
+	o := Overrides{PublicIPv4: netip.MustParseAddr("5.6.7.8"), PublicIPv6: netip.MustParseAddr("2a01:4f8::2"), Exclude: true}
+	got, errs := o.Filter(AddressFilter{Denied: []netip.Prefix{netip.MustParsePrefix("5.6.7.0/24")}})
+	if want := (Overrides{PublicIPv6: netip.MustParseAddr("2a01:4f8::2"), Exclude: true}); got != want {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+	if got, want := len(errs), 1; got != want {
+		t.Fatalf("Got %d errors, want %d", got, want)
+	}
+	if got, want := errs[0].Error(), "invalid annotation exips.io/public-ipv4: 5.6.7.8 is rejected: denied by 5.6.7.0/24"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+
+	// overrides of private addresses are published if allowed
+	allowed := AddressFilter{Allowed: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	n := New(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationPublicIPv4: "10.0.0.1"}}}).WithAddressFilter(allowed)
+	if got, want := n.PublicIPs(), []netip.Addr{netip.MustParseAddr("10.0.0.1")}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package node
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Reasons for excluding a node, reported by the built-in rules.
+const (
+	ReasonNotReady      = "NotReady"
+	ReasonCordoned      = "Cordoned"
+	ReasonTainted       = "Tainted"
+	ReasonLabelMismatch = "LabelMismatch"
+	ReasonFieldMismatch = "FieldMismatch"
+	ReasonCondition     = "Condition"
+	ReasonNoIngressPod  = "NoIngressPod"
+	ReasonAnnotated     = "Annotated"
+)
+
+// Verdict is the outcome of evaluating the eligibility of a node.
+type Verdict struct {
+	Eligible bool
+	// Reason is a short identifier of the rule that excluded the node.
+	Reason string
+	// Message explains why the node was excluded.
+	Message string
+}
+
+// Eligible is the verdict for nodes that are not excluded by a rule.
+var Eligible = Verdict{Eligible: true}
+
+// Excluded returns the verdict for a node excluded for the given reason.
+func Excluded(reason, format string, args ...any) Verdict {
+	return Verdict{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// Eligibility decides whether the IPs of a node are published.
+type Eligibility interface {
+	Evaluate(n Node) Verdict
+}
+
+// EligibilityFunc adapts a function to the Eligibility interface.
+type EligibilityFunc func(n Node) Verdict
+
+// Evaluate calls f(n).
+func (f EligibilityFunc) Evaluate(n Node) Verdict {
+	return f(n)
+}
+
+// All composes rules. A node is eligible if no rule excludes it, otherwise
+// the verdict of the first excluding rule is returned.
+func All(rules ...Eligibility) Eligibility {
+	return EligibilityFunc(func(n Node) Verdict {
+		for _, rule := range rules {
+			if v := rule.Evaluate(n); !v.Eligible {
+				return v
+			}
+		}
+		return Eligible
+	})
+}
+
+// DefaultEligibility includes ready and schedulable nodes, excluding
+// control-plane nodes tainted with
+// node-role.kubernetes.io/control-plane:NoSchedule and nodes annotated with
+// exips.io/exclude.
+func DefaultEligibility() Eligibility {
+	return All(
+		ExcludeAnnotated(),
+		RequireReady(),
+		ExcludeCordoned(),
+		ExcludeTaint(TaintControlPlane, corev1.TaintEffectNoSchedule),
+	)
+}
+
+// RequireReady excludes nodes that are not ready.
+func RequireReady() Eligibility {
+	return EligibilityFunc(func(n Node) Verdict {
+		if !n.IsReady() {
+			return Excluded(ReasonNotReady, "node is not ready")
+		}
+		return Eligible
+	})
+}
+
+// ExcludeAnnotated excludes nodes annotated with exips.io/exclude.
+func ExcludeAnnotated() Eligibility {
+	return EligibilityFunc(func(n Node) Verdict {
+		if n.Overrides().Exclude {
+			return Excluded(ReasonAnnotated, "node is annotated with %s", AnnotationExclude)
+		}
+		return Eligible
+	})
+}
+
+// ExcludeCordoned excludes cordoned nodes.
+func ExcludeCordoned() Eligibility {
+	return EligibilityFunc(func(n Node) Verdict {
+		if !n.IsSchedulable() {
+			return Excluded(ReasonCordoned, "node is cordoned")
+		}
+		return Eligible
+	})
+}
+
+// ExcludeTaint excludes nodes with a taint of the given key and effect.
+// An empty effect matches any effect.
+func ExcludeTaint(key string, effect corev1.TaintEffect) Eligibility {
+	return EligibilityFunc(func(n Node) Verdict {
+		if n.HasTaint(key, effect) {
+			if effect == "" {
+				return Excluded(ReasonTainted, "node has taint %s", key)
+			}
+			return Excluded(ReasonTainted, "node has taint %s:%s", key, effect)
+		}
+		return Eligible
+	})
+}
+
+// RequireLabels excludes nodes whose labels do not match the selector.
+func RequireLabels(selector labels.Selector) Eligibility {
+	return EligibilityFunc(func(n Node) Verdict {
+		if !selector.Matches(labels.Set(n.Labels())) {
+			return Excluded(ReasonLabelMismatch, "node labels do not match %s", selector)
+		}
+		return Eligible
+	})
+}
+
+// RequireFields excludes nodes whose fields do not match the selector.
+func RequireFields(selector fields.Selector) Eligibility {
+	return EligibilityFunc(func(n Node) Verdict {
+		if !selector.Matches(n.Fields()) {
+			return Excluded(ReasonFieldMismatch, "node fields do not match %s", selector)
+		}
+		return Eligible
+	})
+}
+
+// ExcludeCondition excludes nodes reporting the condition with the given
+// status, e.g. NetworkUnavailable or DiskPressure being True.
+func ExcludeCondition(conditionType corev1.NodeConditionType, status corev1.ConditionStatus) Eligibility {
+	return EligibilityFunc(func(n Node) Verdict {
+		if n.ConditionStatus(conditionType) == status {
+			return Excluded(ReasonCondition, "node condition %s is %s", conditionType, status)
+		}
+		return Eligible
+	})
+}
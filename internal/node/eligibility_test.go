@@ -0,0 +1,168 @@
+package node
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestEligibility(t *testing.T) {
+	ready := corev1.NodeCondition{Type: corev1.NodeReady, Status: corev1.ConditionTrue}
+	for _, tc := range []struct {
+		name        string
+		eligibility Eligibility
+		node        *v1Node
+		want        Verdict
+	}{
+		{
+			name:        "no rules",
+			eligibility: All(),
+			node:        New(&corev1.Node{}),
+			want:        Eligible,
+		},
+		{
+			name:        "default eligibility, ready worker",
+			eligibility: DefaultEligibility(),
+			node: New(&corev1.Node{
+				Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{ready}},
+			}),
+			want: Eligible,
+		},
+		{
+			name:        "default eligibility, not ready",
+			eligibility: DefaultEligibility(),
+			node:        New(&corev1.Node{}),
+			want:        Excluded(ReasonNotReady, "node is not ready"),
+		},
+		{
+			name:        "default eligibility, cordoned",
+			eligibility: DefaultEligibility(),
+			node: New(&corev1.Node{
+				Spec: corev1.NodeSpec{
+					Taints: []corev1.Taint{{Key: TaintUnschedulable, Effect: corev1.TaintEffectNoSchedule}},
+				},
+				Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{ready}},
+			}),
+			want: Excluded(ReasonCordoned, "node is cordoned"),
+		},
+		{
+			name:        "default eligibility, control-plane",
+			eligibility: DefaultEligibility(),
+			node: New(&corev1.Node{
+				Spec: corev1.NodeSpec{
+					Taints: []corev1.Taint{{Key: TaintControlPlane, Effect: corev1.TaintEffectNoSchedule}},
+				},
+				Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{ready}},
+			}),
+			want: Excluded(ReasonTainted, "node has taint node-role.kubernetes.io/control-plane:NoSchedule"),
+		},
+		{
+			name:        "default eligibility, annotated",
+			eligibility: DefaultEligibility(),
+			node: New(&corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationExclude: "true"}},
+				Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{ready}},
+			}),
+			want: Excluded(ReasonAnnotated, "node is annotated with exips.io/exclude"),
+		},
+		{
+			name:        "invalid exclude annotation",
+			eligibility: ExcludeAnnotated(),
+			node: New(&corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationExclude: "yes please"}},
+			}),
+			want: Eligible,
+		},
+		{
+			name:        "taint with any effect",
+			eligibility: ExcludeTaint("dedicated", ""),
+			node: New(&corev1.Node{
+				Spec: corev1.NodeSpec{
+					Taints: []corev1.Taint{{Key: "dedicated", Value: "db", Effect: corev1.TaintEffectNoExecute}},
+				},
+			}),
+			want: Excluded(ReasonTainted, "node has taint dedicated"),
+		},
+		{
+			name:        "taint with other effect",
+			eligibility: ExcludeTaint("dedicated", corev1.TaintEffectNoSchedule),
+			node: New(&corev1.Node{
+				Spec: corev1.NodeSpec{
+					Taints: []corev1.Taint{{Key: "dedicated", Value: "db", Effect: corev1.TaintEffectNoExecute}},
+				},
+			}),
+			want: Eligible,
+		},
+		{
+			name:        "labels match",
+			eligibility: RequireLabels(labels.SelectorFromSet(labels.Set{"ingress": "true"})),
+			node: New(&corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"ingress": "true"}},
+			}),
+			want: Eligible,
+		},
+		{
+			name:        "labels do not match",
+			eligibility: RequireLabels(labels.SelectorFromSet(labels.Set{"ingress": "true"})),
+			node:        New(&corev1.Node{}),
+			want:        Excluded(ReasonLabelMismatch, "node labels do not match ingress=true"),
+		},
+		{
+			name:        "fields match",
+			eligibility: RequireFields(fields.OneTermEqualSelector("metadata.name", "w-1")),
+			node: New(&corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "w-1"},
+			}),
+			want: Eligible,
+		},
+		{
+			name:        "fields do not match",
+			eligibility: RequireFields(fields.OneTermEqualSelector("spec.unschedulable", "false")),
+			node: New(&corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "w-1"},
+				Spec:       corev1.NodeSpec{Unschedulable: true},
+			}),
+			want: Excluded(ReasonFieldMismatch, "node fields do not match spec.unschedulable=false"),
+		},
+		{
+			name:        "network unavailable",
+			eligibility: ExcludeCondition(corev1.NodeNetworkUnavailable, corev1.ConditionTrue),
+			node: New(&corev1.Node{
+				Status: corev1.NodeStatus{
+					Conditions: []corev1.NodeCondition{{Type: corev1.NodeNetworkUnavailable, Status: corev1.ConditionTrue}},
+				},
+			}),
+			want: Excluded(ReasonCondition, "node condition NetworkUnavailable is True"),
+		},
+		{
+			name:        "network available",
+			eligibility: ExcludeCondition(corev1.NodeNetworkUnavailable, corev1.ConditionTrue),
+			node: New(&corev1.Node{
+				Status: corev1.NodeStatus{
+					Conditions: []corev1.NodeCondition{{Type: corev1.NodeNetworkUnavailable, Status: corev1.ConditionFalse}},
+				},
+			}),
+			want: Eligible,
+		},
+		{
+			name: "first excluding rule wins",
+			eligibility: All(
+				ExcludeCondition(corev1.NodeDiskPressure, corev1.ConditionTrue),
+				RequireReady(),
+			),
+			node: New(&corev1.Node{
+				Status: corev1.NodeStatus{
+					Conditions: []corev1.NodeCondition{{Type: corev1.NodeDiskPressure, Status: corev1.ConditionTrue}},
+				},
+			}),
+			want: Excluded(ReasonCondition, "node condition DiskPressure is True"),
+		},
+	} {
+		if got, want := tc.eligibility.Evaluate(tc.node), tc.want; got != want {
+			t.Errorf("%s: Got %+v, want %+v", tc.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package node
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// FamilyPolicy decides which IP families of a node get published.
+type FamilyPolicy string
+
+const (
+	// FamilyPolicyIPv4Only publishes the public IPv4 address only.
+	FamilyPolicyIPv4Only FamilyPolicy = "IPv4Only"
+	// FamilyPolicyIPv6Only publishes the public IPv6 address only.
+	FamilyPolicyIPv6Only FamilyPolicy = "IPv6Only"
+	// FamilyPolicyDualStack publishes both the public IPv4 and IPv6 address.
+	FamilyPolicyDualStack FamilyPolicy = "DualStack"
+	// FamilyPolicyPreferIPv4 publishes the public IPv4 address, falling back
+	// to the public IPv6 address for IPv6-only nodes.
+	FamilyPolicyPreferIPv4 FamilyPolicy = "PreferIPv4"
+	// FamilyPolicyPreferIPv6 publishes the public IPv6 address, falling back
+	// to the public IPv4 address for IPv4-only nodes.
+	FamilyPolicyPreferIPv6 FamilyPolicy = "PreferIPv6"
+)
+
+// DefaultFamilyPolicy publishes a single IP per node, like exips always did.
+const DefaultFamilyPolicy = FamilyPolicyPreferIPv4
+
+// ParseFamilyPolicy returns the FamilyPolicy named s.
+func ParseFamilyPolicy(s string) (FamilyPolicy, error) {
+	switch p := FamilyPolicy(s); p {
+	case FamilyPolicyIPv4Only, FamilyPolicyIPv6Only, FamilyPolicyDualStack, FamilyPolicyPreferIPv4, FamilyPolicyPreferIPv6:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid IP family policy %q", s)
+}
+
+// Select returns the IPs allowed by the policy, keeping their order.
+// ips is expected to hold at most one IP per family, as returned by
+// Node.PublicIPs.
+func (p FamilyPolicy) Select(ips []netip.Addr) []netip.Addr {
+	var ipv4, ipv6 []netip.Addr
+	for _, ip := range ips {
+		if ip.Is4() {
+			ipv4 = append(ipv4, ip)
+		} else {
+			ipv6 = append(ipv6, ip)
+		}
+	}
+	switch p {
+	case FamilyPolicyIPv4Only:
+		return ipv4
+	case FamilyPolicyIPv6Only:
+		return ipv6
+	case FamilyPolicyPreferIPv4:
+		if len(ipv4) > 0 {
+			return ipv4
+		}
+		return ipv6
+	case FamilyPolicyPreferIPv6:
+		if len(ipv6) > 0 {
+			return ipv6
+		}
+		return ipv4
+	default: // FamilyPolicyDualStack
+		return ips
+	}
+}
+
+// Allows returns true if the policy publishes IPs of the family of the IP,
+// which is false for the other family of IPv4Only and IPv6Only only.
+func (p FamilyPolicy) Allows(ip netip.Addr) bool {
+	switch p {
+	case FamilyPolicyIPv4Only:
+		return ip.Is4()
+	case FamilyPolicyIPv6Only:
+		return ip.Is6()
+	default:
+		return true
+	}
+}
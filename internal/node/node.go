@@ -4,46 +4,112 @@ import (
 	"errors"
 	"log/slog"
 	"net/netip"
+	"strconv"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 )
 
 var ErrNoPublicIP = errors.New("error: no public IP")
 
+const (
+	// TaintUnschedulable is the taint of cordoned nodes.
+	TaintUnschedulable = "node.kubernetes.io/unschedulable"
+	// TaintControlPlane prevents scheduling workloads on control-plane nodes.
+	TaintControlPlane = "node-role.kubernetes.io/control-plane"
+)
+
 // INTERFACE
 
 // Node interface
 type Node interface {
 	Name() string
+	Labels() map[string]string
+	Fields() fields.Set
+	HasTaint(key string, effect corev1.TaintEffect) bool
+	ConditionStatus(conditionType corev1.NodeConditionType) corev1.ConditionStatus
 	IsReady() bool
 	IsSchedulable() bool
 	IsControlPlaneSchedulable() bool
 	PublicIP() (netip.Addr, error)
+	PublicIPs() []netip.Addr
+	PublicIPsByType(addressTypes []corev1.NodeAddressType) []netip.Addr
+	RejectedIPs() []RejectedIP
+	InternalIPs() []netip.Addr
+	Addresses() []corev1.NodeAddress
+	Taints() []corev1.Taint
+	Overrides() Overrides
 }
 
 // CONSTRUCTORS
 
 // New constructs a v1Node instance
 func New(n *corev1.Node) *v1Node {
-	return &v1Node{node: n}
+	overrides, _ := ParseOverrides(n.Annotations) // invalid annotations are reported by the registry
+	return &v1Node{node: n, overrides: overrides}
 }
 
 // NewDummyNode constructs a dummyNode instance
 func NewDummyNode(name string, isReady, isSchedulable, isControlPlaneSchedulable bool, publicIP *netip.Addr) *dummyNode {
-	return &dummyNode{
+	n := &dummyNode{
 		name:                      name,
 		isReady:                   isReady,
 		isSchedulable:             isSchedulable,
 		isControlPlaneSchedulable: isControlPlaneSchedulable,
 		publicIP:                  publicIP,
 	}
+	if publicIP != nil {
+		n.publicIPs = []netip.Addr{*publicIP}
+	}
+	return n
+}
+
+// NewDualStackDummyNode constructs a dummyNode instance with several public
+// IPs. The first one is returned by PublicIP.
+func NewDualStackDummyNode(name string, isReady, isSchedulable, isControlPlaneSchedulable bool, publicIPs ...netip.Addr) *dummyNode {
+	n := &dummyNode{
+		name:                      name,
+		isReady:                   isReady,
+		isSchedulable:             isSchedulable,
+		isControlPlaneSchedulable: isControlPlaneSchedulable,
+		publicIPs:                 publicIPs,
+	}
+	if len(publicIPs) > 0 {
+		n.publicIP = &publicIPs[0]
+	}
+	return n
 }
 
 // IMPLEMENTATIONS
 
 // v1Node is the anti-corruption layer for corev1 Kubernetes Node objects.
 type v1Node struct {
-	node *corev1.Node
+	node         *corev1.Node
+	filter       AddressFilter
+	addressTypes []corev1.NodeAddressType // DefaultAddressTypes if empty
+	resolved     map[string][]netip.Addr  // IPs of the names, ignored if nil
+	overrides    Overrides
+}
+
+// WithAddressFilter sets the filter deciding which addresses are public.
+func (n *v1Node) WithAddressFilter(f AddressFilter) *v1Node {
+	n.filter = f
+	return n
+}
+
+// WithAddressTypes sets the address types in order of precedence.
+func (n *v1Node) WithAddressTypes(addressTypes []corev1.NodeAddressType) *v1Node {
+	n.addressTypes = addressTypes
+	return n
+}
+
+// WithResolved sets the IPs the names of the Hostname, ExternalDNS and
+// InternalDNS addresses resolved to, by name. Names are ignored without it,
+// and so are names missing from it, so reading the IPs of the node never
+// waits for DNS.
+func (n *v1Node) WithResolved(resolved map[string][]netip.Addr) *v1Node {
+	n.resolved = resolved
+	return n
 }
 
 // Name of the node
@@ -51,6 +117,41 @@ func (n *v1Node) Name() string {
 	return n.node.Name
 }
 
+// Labels of the node
+func (n *v1Node) Labels() map[string]string {
+	return n.node.Labels
+}
+
+// Fields returns the fields of the node supported by field selectors.
+func (n *v1Node) Fields() fields.Set {
+	return fields.Set{
+		"metadata.name":      n.node.Name,
+		"spec.unschedulable": strconv.FormatBool(n.node.Spec.Unschedulable),
+	}
+}
+
+// HasTaint returns true if the node has a taint with the given key and
+// effect. An empty effect matches any effect.
+func (n *v1Node) HasTaint(key string, effect corev1.TaintEffect) bool {
+	for _, taint := range n.node.Spec.Taints {
+		if taint.Key == key && (effect == "" || taint.Effect == effect) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConditionStatus returns the status of the given node condition, or an
+// empty status if the node does not report the condition.
+func (n *v1Node) ConditionStatus(conditionType corev1.NodeConditionType) corev1.ConditionStatus {
+	for _, cond := range n.node.Status.Conditions {
+		if cond.Type == conditionType {
+			return cond.Status
+		}
+	}
+	return ""
+}
+
 // IsReady returns true when NodeReady condition is true (not false and not unknown).
 func (n *v1Node) IsReady() bool {
 	for _, cond := range n.node.Status.Conditions {
@@ -63,72 +164,177 @@ func (n *v1Node) IsReady() bool {
 
 // IsSchedulable returns true if there is no current unschedulable node taint.
 func (n *v1Node) IsSchedulable() bool {
-	for _, taint := range n.node.Spec.Taints {
-		if taint.Key == "node.kubernetes.io/unschedulable" && taint.Effect == corev1.TaintEffectNoSchedule {
-			return false
-		}
-	}
-	return true
+	return !n.HasTaint(TaintUnschedulable, corev1.TaintEffectNoSchedule)
 }
 
 // IsControlPlaneSchedulable returns true if there is no taint to prevent
 // scheduling on control plane. Worker nodes return true.
 func (n *v1Node) IsControlPlaneSchedulable() bool {
-	for _, taint := range n.node.Spec.Taints {
-		if taint.Key == "node-role.kubernetes.io/control-plane" && taint.Effect == corev1.TaintEffectNoSchedule {
-			return false
-		}
-	}
-	return true
+	return !n.HasTaint(TaintControlPlane, corev1.TaintEffectNoSchedule)
 }
 
-// PublicIP returns the first non private external or internal IP
+// PublicIP returns the overridden public IPv4 or IPv6 address, or the first
+// public IP, earlier address types taking precedence over later ones.
 func (n *v1Node) PublicIP() (netip.Addr, error) {
-	pubExtIP, err := n.PublicExternalIP()
-	if err == nil {
-		return pubExtIP, nil
+	overrides := n.Overrides()
+	for _, ip := range []netip.Addr{overrides.PublicIPv4, overrides.PublicIPv6} {
+		if ip.IsValid() {
+			return ip, nil
+		}
 	}
-	pubIntIP, err := n.PublicInternalIP()
-	if err == nil {
-		return pubIntIP, nil
+	for _, addrType := range n.precedence() {
+		if ip, err := n.firstPublicIP(addrType); err == nil {
+			return ip, nil
+		}
 	}
 	return netip.Addr{}, ErrNoPublicIP
 }
 
-// PublicInternalIP returns the non private internal IP
-func (n *v1Node) PublicInternalIP() (netip.Addr, error) {
-	for _, addr := range n.node.Status.Addresses {
-		if addr.Type == corev1.NodeInternalIP {
-			ip, err := netip.ParseAddr(addr.Address)
-			if err != nil {
-				slog.Debug("ignoring error when parsing internal IP", "node", n.node.Name, "addr", addr.Address)
-				continue
-			}
-			if !ip.IsPrivate() {
-				return ip, nil
+// PublicIPs returns the first public IPv4 and the first public IPv6
+// address of the node, earlier address types taking precedence over later
+// ones in each family, by default external IPs over internal IPs. Overrides
+// of the node take precedence over its addresses. IPv4 comes first. The
+// result is empty if there is no public IP.
+func (n *v1Node) PublicIPs() []netip.Addr {
+	return n.PublicIPsByType(nil)
+}
+
+// PublicIPsByType is like PublicIPs, but only considers addresses of the given
+// types, earlier types taking precedence over later ones. The address types of
+// the node are used if no types are given.
+func (n *v1Node) PublicIPsByType(addressTypes []corev1.NodeAddressType) []netip.Addr {
+	if len(addressTypes) == 0 {
+		addressTypes = n.precedence()
+	}
+	return n.Overrides().apply(n.firstIPs(addressTypes, n.isPublic))
+}
+
+// RejectedIPs returns the IPs of the address types of the node that the
+// address filter rejects, in order of precedence.
+func (n *v1Node) RejectedIPs() []RejectedIP {
+	var rejected []RejectedIP
+	for _, addrType := range n.precedence() {
+		for _, ip := range n.ipsByType(addrType) {
+			if ok, rule := n.filter.Accept(ip); !ok {
+				rejected = append(rejected, RejectedIP{IP: ip, Type: addrType, Rule: rule})
 			}
 		}
 	}
-	return netip.Addr{}, ErrNoPublicIP
+	return rejected
 }
 
-// PublicExternalIP returns the first non private IP
-func (n *v1Node) PublicExternalIP() (netip.Addr, error) {
-	for _, addr := range n.node.Status.Addresses {
-		if addr.Type == corev1.NodeExternalIP {
-			ip, err := netip.ParseAddr(addr.Address)
-			if err != nil {
-				slog.Debug("ignoring error when parsing external IP", "node", n.node.Name, "addr", addr.Address)
+// precedence returns the address types of the node, DefaultAddressTypes if
+// none are set.
+func (n *v1Node) precedence() []corev1.NodeAddressType {
+	if len(n.addressTypes) > 0 {
+		return n.addressTypes
+	}
+	return DefaultAddressTypes
+}
+
+// InternalIPs returns the first internal IPv4 and the first internal IPv6
+// address of the node, private or not. IPv4 comes first.
+func (n *v1Node) InternalIPs() []netip.Addr {
+	return n.firstIPs([]corev1.NodeAddressType{corev1.NodeInternalIP}, func(netip.Addr) bool {
+		return true
+	})
+}
+
+// firstIPs returns the first IPv4 and the first IPv6 address of the given
+// types that is accepted, earlier types taking precedence over later ones.
+func (n *v1Node) firstIPs(addressTypes []corev1.NodeAddressType, accept func(netip.Addr) bool) []netip.Addr {
+	var ipv4, ipv6 netip.Addr
+	for _, addrType := range addressTypes {
+		for _, ip := range n.ipsByType(addrType) {
+			if !accept(ip) {
 				continue
 			}
-			if !ip.IsPrivate() {
-				return ip, nil
+			if ip.Is4() && !ipv4.IsValid() {
+				ipv4 = ip
 			}
+			if ip.Is6() && !ipv6.IsValid() {
+				ipv6 = ip
+			}
+		}
+	}
+	ips := make([]netip.Addr, 0, 2)
+	for _, ip := range []netip.Addr{ipv4, ipv6} {
+		if ip.IsValid() {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// firstPublicIP returns the first public IP of the address type.
+func (n *v1Node) firstPublicIP(addrType corev1.NodeAddressType) (netip.Addr, error) {
+	for _, ip := range n.ipsByType(addrType) {
+		if n.isPublic(ip) {
+			return ip, nil
 		}
 	}
 	return netip.Addr{}, ErrNoPublicIP
 }
 
+// ipsByType returns the IPs of the addresses of the type, in the order of the
+// node status. Names are replaced by the IPs they resolved to, if any.
+func (n *v1Node) ipsByType(addrType corev1.NodeAddressType) []netip.Addr {
+	var ips []netip.Addr
+	for _, addr := range n.node.Status.Addresses {
+		if addr.Type != addrType {
+			continue
+		}
+		if IsNameAddressType(addr.Type) {
+			ips = append(ips, n.resolved[addr.Address]...)
+			continue
+		}
+		ip, err := netip.ParseAddr(addr.Address)
+		if err != nil {
+			slog.Debug("ignoring error when parsing IP", "node", n.node.Name, "addr", addr.Address, "type", addr.Type)
+			continue
+		}
+		ips = append(ips, ip.Unmap())
+	}
+	return ips
+}
+
+// isPublic returns true if the address filter accepts the IP, logging the
+// rule that rejected it otherwise.
+func (n *v1Node) isPublic(ip netip.Addr) bool {
+	ok, rule := n.filter.Accept(ip)
+	if !ok {
+		slog.Debug("ignoring IP", "node", n.node.Name, "addr", ip, "rule", rule)
+	}
+	return ok
+}
+
+// Addresses of the node as reported in its status.
+func (n *v1Node) Addresses() []corev1.NodeAddress {
+	return n.node.Status.Addresses
+}
+
+// Taints of the node.
+func (n *v1Node) Taints() []corev1.Taint {
+	return n.node.Spec.Taints
+}
+
+// Overrides of the node by its annotations, without the IPs the address
+// filter rejects.
+func (n *v1Node) Overrides() Overrides {
+	overrides, _ := n.overrides.Filter(n.filter) // rejected IPs are reported by the registry
+	return overrides
+}
+
+// PublicInternalIP returns the first public internal IP
+func (n *v1Node) PublicInternalIP() (netip.Addr, error) {
+	return n.firstPublicIP(corev1.NodeInternalIP)
+}
+
+// PublicExternalIP returns the first public external IP
+func (n *v1Node) PublicExternalIP() (netip.Addr, error) {
+	return n.firstPublicIP(corev1.NodeExternalIP)
+}
+
 // dummyNode satisfies the Node interface and can be used in tests.
 type dummyNode struct {
 	name                      string
@@ -136,12 +342,64 @@ type dummyNode struct {
 	isSchedulable             bool
 	isControlPlaneSchedulable bool
 	publicIP                  *netip.Addr
+	publicIPs                 []netip.Addr
+	labels                    map[string]string
+	overrides                 Overrides
 }
 
 func (n *dummyNode) Name() string {
 	return n.name
 }
 
+// WithLabels sets the labels of the dummyNode and returns it.
+func (n *dummyNode) WithLabels(labels map[string]string) *dummyNode {
+	n.labels = labels
+	return n
+}
+
+// WithOverrides sets the overrides of the dummyNode and returns it.
+func (n *dummyNode) WithOverrides(o Overrides) *dummyNode {
+	n.overrides = o
+	return n
+}
+
+func (n *dummyNode) Labels() map[string]string {
+	return n.labels
+}
+
+func (n *dummyNode) Fields() fields.Set {
+	return fields.Set{
+		"metadata.name":      n.name,
+		"spec.unschedulable": strconv.FormatBool(!n.isSchedulable),
+	}
+}
+
+// HasTaint knows the unschedulable and the control-plane taint, depending on
+// isSchedulable and isControlPlaneSchedulable.
+func (n *dummyNode) HasTaint(key string, effect corev1.TaintEffect) bool {
+	if effect != "" && effect != corev1.TaintEffectNoSchedule {
+		return false
+	}
+	switch key {
+	case TaintUnschedulable:
+		return !n.isSchedulable
+	case TaintControlPlane:
+		return !n.isControlPlaneSchedulable
+	}
+	return false
+}
+
+// ConditionStatus knows the Ready condition only, depending on isReady.
+func (n *dummyNode) ConditionStatus(conditionType corev1.NodeConditionType) corev1.ConditionStatus {
+	if conditionType != corev1.NodeReady {
+		return ""
+	}
+	if n.isReady {
+		return corev1.ConditionTrue
+	}
+	return corev1.ConditionFalse
+}
+
 func (n *dummyNode) IsReady() bool {
 	return n.isReady
 }
@@ -160,3 +418,45 @@ func (n *dummyNode) PublicIP() (netip.Addr, error) {
 	}
 	return *n.publicIP, nil
 }
+
+func (n *dummyNode) PublicIPs() []netip.Addr {
+	return n.publicIPs
+}
+
+func (n *dummyNode) PublicIPsByType([]corev1.NodeAddressType) []netip.Addr {
+	return n.publicIPs
+}
+
+// RejectedIPs returns nothing, dummy nodes have public IPs only.
+func (n *dummyNode) RejectedIPs() []RejectedIP {
+	return nil
+}
+
+// InternalIPs returns the public IPs, dummy nodes have no other addresses.
+func (n *dummyNode) InternalIPs() []netip.Addr {
+	return n.publicIPs
+}
+
+// Addresses returns the public IPs as external IPs.
+func (n *dummyNode) Addresses() []corev1.NodeAddress {
+	addresses := make([]corev1.NodeAddress, len(n.publicIPs))
+	for i, ip := range n.publicIPs {
+		addresses[i] = corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: ip.String()}
+	}
+	return addresses
+}
+
+// Taints knows the unschedulable and the control-plane taint, like HasTaint.
+func (n *dummyNode) Taints() []corev1.Taint {
+	var taints []corev1.Taint
+	for _, key := range []string{TaintUnschedulable, TaintControlPlane} {
+		if n.HasTaint(key, corev1.TaintEffectNoSchedule) {
+			taints = append(taints, corev1.Taint{Key: key, Effect: corev1.TaintEffectNoSchedule})
+		}
+	}
+	return taints
+}
+
+func (n *dummyNode) Overrides() Overrides {
+	return n.overrides
+}
@@ -1,7 +1,10 @@
 package node
 
 import (
+	"context"
+	"errors"
 	"net/netip"
+	"slices"
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
@@ -108,6 +111,20 @@ func TestNodePublicInternalIP(t *testing.T) {
 			}),
 			shouldRaiseError: true,
 		},
+		{
+			name: "IPv4-mapped private internal IP",
+			node: New(&corev1.Node{
+				Status: corev1.NodeStatus{
+					Addresses: []corev1.NodeAddress{
+						{
+							Address: "::ffff:10.0.0.1",
+							Type:    corev1.NodeInternalIP,
+						},
+					},
+				},
+			}),
+			shouldRaiseError: true,
+		},
 		{
 			name: "public internal IP",
 			node: New(&corev1.Node{
@@ -223,6 +240,218 @@ func TestNodePublicIP(t *testing.T) {
 	}
 }
 
+func TestNodePublicIPs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		node *v1Node
+		want []netip.Addr
+	}{
+		{
+			name: "no public IP",
+			node: New(&corev1.Node{
+				Status: corev1.NodeStatus{
+					Addresses: []corev1.NodeAddress{
+						{
+							Address: "192.168.0.2",
+							Type:    corev1.NodeInternalIP,
+						},
+						{
+							Address: "fd00::2",
+							Type:    corev1.NodeInternalIP,
+						},
+					},
+				},
+			}),
+			want: []netip.Addr{},
+		},
+		{
+			name: "public external IPv4 and IPv6",
+			node: New(&corev1.Node{
+				Status: corev1.NodeStatus{
+					Addresses: []corev1.NodeAddress{
+						{
+							Address: "192.168.0.2",
+							Type:    corev1.NodeInternalIP,
+						},
+						{
+							Address: "2a01:4f8::1",
+							Type:    corev1.NodeExternalIP,
+						},
+						{
+							Address: "1.2.3.4",
+							Type:    corev1.NodeExternalIP,
+						},
+					},
+				},
+			}),
+			want: []netip.Addr{netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2a01:4f8::1")},
+		},
+		{
+			name: "external IPs take precedence within each family",
+			node: New(&corev1.Node{
+				Status: corev1.NodeStatus{
+					Addresses: []corev1.NodeAddress{
+						{
+							Address: "11.22.33.44",
+							Type:    corev1.NodeInternalIP,
+						},
+						{
+							Address: "2a01:4f8::2",
+							Type:    corev1.NodeInternalIP,
+						},
+						{
+							Address: "1.2.3.4",
+							Type:    corev1.NodeExternalIP,
+						},
+					},
+				},
+			}),
+			want: []netip.Addr{netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2a01:4f8::2")},
+		},
+		{
+			name: "IPv4-mapped private IP",
+			node: New(&corev1.Node{
+				Status: corev1.NodeStatus{
+					Addresses: []corev1.NodeAddress{
+						{
+							Address: "::ffff:10.0.0.1",
+							Type:    corev1.NodeExternalIP,
+						},
+						{
+							Address: "1.2.3.4",
+							Type:    corev1.NodeInternalIP,
+						},
+					},
+				},
+			}),
+			want: []netip.Addr{netip.MustParseAddr("1.2.3.4")},
+		},
+	} {
+		if got, want := tc.node.PublicIPs(), tc.want; !slices.Equal(got, want) {
+			t.Errorf("%s: Got %v, want %v", tc.name, got, want)
+		}
+	}
+}
+
+func TestNodePublicIPsByType(t *testing.T) {
+	n := New(&corev1.Node{
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Address: "1.2.3.4", Type: corev1.NodeExternalIP},
+				{Address: "11.22.33.44", Type: corev1.NodeInternalIP},
+			},
+		},
+	})
+	for _, tc := range []struct {
+		addressTypes []corev1.NodeAddressType
+		want         []netip.Addr
+	}{
+		{nil, []netip.Addr{netip.MustParseAddr("1.2.3.4")}},
+		{[]corev1.NodeAddressType{corev1.NodeInternalIP, corev1.NodeExternalIP}, []netip.Addr{netip.MustParseAddr("11.22.33.44")}},
+		{[]corev1.NodeAddressType{corev1.NodeInternalIP}, []netip.Addr{netip.MustParseAddr("11.22.33.44")}},
+		{[]corev1.NodeAddressType{corev1.NodeHostName}, []netip.Addr{}},
+	} {
+		if got, want := n.PublicIPsByType(tc.addressTypes), tc.want; !slices.Equal(got, want) {
+			t.Errorf("%v: Got %v, want %v", tc.addressTypes, got, want)
+		}
+	}
+}
+
+type resolverFunc func(host string) ([]netip.Addr, error)
+
+func (f resolverFunc) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	return f(host)
+}
+
+func TestNodeAddressTypes(t *testing.T) {
+	n := New(&corev1.Node{
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Address: "1.2.3.4", Type: corev1.NodeExternalIP},
+				{Address: "node.example.com", Type: corev1.NodeExternalDNS},
+				{Address: "11.22.33.44", Type: corev1.NodeInternalIP},
+			},
+		},
+	}).WithAddressTypes([]corev1.NodeAddressType{corev1.NodeExternalDNS, corev1.NodeInternalIP})
+
+	// names are ignored without a resolver
+	if got, want := n.PublicIPs(), []netip.Addr{netip.MustParseAddr("11.22.33.44")}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	if got, err := n.PublicIP(); err != nil || got != netip.MustParseAddr("11.22.33.44") {
+		t.Errorf("Got %v (%v), want 11.22.33.44", got, err)
+	}
+
+	n.WithResolved(map[string][]netip.Addr{
+		"node.example.com": {netip.MustParseAddr("2.3.4.5"), netip.MustParseAddr("5.6.7.8"), netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("2a01:4f8::1")},
+	})
+	if got, want := n.PublicIPs(), []netip.Addr{netip.MustParseAddr("2.3.4.5"), netip.MustParseAddr("2a01:4f8::1")}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	if got, err := n.PublicIP(); err != nil || got != netip.MustParseAddr("2.3.4.5") {
+		t.Errorf("Got %v (%v), want 2.3.4.5", got, err)
+	}
+	if got, want := n.PublicIPsByType([]corev1.NodeAddressType{corev1.NodeExternalIP}), []netip.Addr{netip.MustParseAddr("1.2.3.4")}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+
+	// names that did not resolve are ignored
+	n.WithResolved(map[string][]netip.Addr{})
+	if got, want := n.PublicIPs(), []netip.Addr{netip.MustParseAddr("11.22.33.44")}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r := resolverFunc(func(host string) ([]netip.Addr, error) {
+		if host != "node.example.com" {
+			return nil, errors.New("no such host")
+		}
+		return []netip.Addr{netip.MustParseAddr("2a01:4f8::1"), netip.MustParseAddr("::ffff:5.6.7.8"), netip.MustParseAddr("2.3.4.5")}, nil
+	})
+	got, err := Resolve(context.Background(), r, "node.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []netip.Addr{netip.MustParseAddr("2.3.4.5"), netip.MustParseAddr("5.6.7.8"), netip.MustParseAddr("2a01:4f8::1")}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	if _, err := Resolve(context.Background(), r, "other.example.com"); err == nil {
+		t.Error("unknown name did not raise error")
+	}
+}
+
+func TestNodeInternalIPs(t *testing.T) {
+	n := New(&corev1.Node{
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Address: "1.2.3.4", Type: corev1.NodeExternalIP},
+				{Address: "fd00::1", Type: corev1.NodeInternalIP},
+				{Address: "10.0.0.1", Type: corev1.NodeInternalIP},
+				{Address: "10.0.0.2", Type: corev1.NodeInternalIP},
+			},
+		},
+	})
+	if got, want := n.InternalIPs(), []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("fd00::1")}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func TestParseFamilyPolicy(t *testing.T) {
+	for _, s := range []string{"IPv4Only", "IPv6Only", "DualStack", "PreferIPv4", "PreferIPv6"} {
+		p, err := ParseFamilyPolicy(s)
+		if err != nil {
+			t.Errorf("%s raised error: %s", s, err)
+		}
+		if got, want := string(p), s; got != want {
+			t.Errorf("Got %s, want %s", got, want)
+		}
+	}
+	if _, err := ParseFamilyPolicy("ipv4"); err == nil {
+		t.Error("invalid policy did not raise error")
+	}
+}
+
 func TestImplementsNode(t *testing.T) {
 	var _ Node = &v1Node{}
 }
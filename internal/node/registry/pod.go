@@ -0,0 +1,130 @@
+package registry
+
+import (
+	"time"
+
+	"github.com/fabiant7t/exips/internal/metrics"
+	"github.com/fabiant7t/exips/internal/node"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// podState is what the registry remembers about an ingress controller pod.
+type podState struct {
+	nodeName string
+	ready    bool
+}
+
+// WithPodSelector makes the registry track the ingress controller pods
+// matching the selector in the namespace (all namespaces if empty), so
+// RequireIngressPod can tell which nodes run a ready one.
+func WithPodSelector(namespace string, selector labels.Selector) Option {
+	return func(r *Registry) {
+		r.podNamespace = namespace
+		r.podSelector = selector
+	}
+}
+
+// isPodReady returns true if the pod is bound to a node, running, not
+// terminating and its PodReady condition is true.
+func isPodReady(p *corev1.Pod) bool {
+	if p.Spec.NodeName == "" || p.DeletionTimestamp != nil || p.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, cond := range p.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func (r *Registry) setPod(key string, p *corev1.Pod) {
+	r.mu.Lock()
+	r.pods[key] = podState{nodeName: p.Spec.NodeName, ready: isPodReady(p)}
+	r.mu.Unlock()
+
+	r.notify()
+}
+
+func (r *Registry) deletePod(key string) {
+	r.mu.Lock()
+	delete(r.pods, key)
+	r.mu.Unlock()
+
+	r.notify()
+}
+
+// HasReadyPod returns true if a ready ingress controller pod runs on the node.
+func (r *Registry) HasReadyPod(nodeName string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, p := range r.pods {
+		if p.nodeName == nodeName && p.ready {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireIngressPod excludes nodes without a ready ingress controller pod.
+// It requires the registry to be created using WithPodSelector.
+func (r *Registry) RequireIngressPod() node.Eligibility {
+	return node.EligibilityFunc(func(n node.Node) node.Verdict {
+		if !r.HasReadyPod(n.Name()) {
+			return node.Excluded(node.ReasonNoIngressPod, "no ready ingress controller pod matching %s runs on the node", r.podSelector)
+		}
+		return node.Eligible
+	})
+}
+
+// podInformer returns an informer factory and an informer syncing the
+// ingress controller pods into the registry.
+func (r *Registry) podInformer(client kubernetes.Interface, defaultResync time.Duration) (informers.SharedInformerFactory, cache.SharedIndexInformer, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, defaultResync,
+		informers.WithNamespace(r.podNamespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = r.podSelector.String()
+		}),
+	)
+	podInformer := factory.Core().V1().Pods().Informer()
+
+	set := func(event string, obj any) {
+		p, ok := obj.(*corev1.Pod)
+		if !ok || p == nil {
+			return
+		}
+		key, err := cache.MetaNamespaceKeyFunc(p)
+		if err != nil {
+			return
+		}
+		metrics.RegistryEvents.WithLabelValues("pod", event).Inc()
+		r.setPod(key, p)
+	}
+	_, err := podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			set("add", obj)
+		},
+		UpdateFunc: func(_, newObj any) {
+			set("update", newObj)
+		},
+		DeleteFunc: func(obj any) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err != nil {
+				return
+			}
+			metrics.RegistryEvents.WithLabelValues("pod", "delete").Inc()
+			r.deletePod(key)
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return factory, podInformer, nil
+}
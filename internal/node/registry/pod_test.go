@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/fabiant7t/exips/internal/node"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func pod(nodeName string, phase corev1.PodPhase, ready corev1.ConditionStatus) *corev1.Pod {
+	return &corev1.Pod{
+		Spec: corev1.PodSpec{NodeName: nodeName},
+		Status: corev1.PodStatus{
+			Phase:      phase,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+		},
+	}
+}
+
+func TestIsPodReady(t *testing.T) {
+	terminating := pod("w-1", corev1.PodRunning, corev1.ConditionTrue)
+	terminating.DeletionTimestamp = &metav1.Time{}
+	for _, tc := range []struct {
+		name string
+		pod  *corev1.Pod
+		want bool
+	}{
+		{name: "ready", pod: pod("w-1", corev1.PodRunning, corev1.ConditionTrue), want: true},
+		{name: "not ready", pod: pod("w-1", corev1.PodRunning, corev1.ConditionFalse), want: false},
+		{name: "pending", pod: pod("w-1", corev1.PodPending, corev1.ConditionFalse), want: false},
+		{name: "unscheduled", pod: pod("", corev1.PodRunning, corev1.ConditionTrue), want: false},
+		{name: "terminating", pod: terminating, want: false},
+	} {
+		if got, want := isPodReady(tc.pod), tc.want; got != want {
+			t.Errorf("%s: Got %t, want %t", tc.name, got, want)
+		}
+	}
+}
+
+func TestRequireIngressPod(t *testing.T) {
+	reg := New(WithPodSelector("traefik", labels.SelectorFromSet(labels.Set{"app": "traefik"})))
+	reg.add(node.NewDummyNode("w-1", true, true, true, ptr(netip.MustParseAddr("1.2.3.4"))))
+	reg.add(node.NewDummyNode("w-2", true, true, true, ptr(netip.MustParseAddr("2.3.4.5"))))
+	reg.add(node.NewDummyNode("w-3", true, true, true, ptr(netip.MustParseAddr("3.4.5.6"))))
+	reg.setPod("traefik/traefik-a", pod("w-1", corev1.PodRunning, corev1.ConditionTrue))
+	reg.setPod("traefik/traefik-b", pod("w-2", corev1.PodRunning, corev1.ConditionFalse))
+
+	eligibility := node.All(node.DefaultEligibility(), reg.RequireIngressPod())
+	got := reg.ParseExternalIPs(eligibility, node.DefaultFamilyPolicy)
+	want := []netip.Addr{netip.MustParseAddr("1.2.3.4")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+
+	// pod on w-2 becomes ready, pod on w-1 is deleted during a rollout
+	reg.setPod("traefik/traefik-b", pod("w-2", corev1.PodRunning, corev1.ConditionTrue))
+	reg.deletePod("traefik/traefik-a")
+	got = reg.ParseExternalIPs(eligibility, node.DefaultFamilyPolicy)
+	want = []netip.Addr{netip.MustParseAddr("2.3.4.5")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+}
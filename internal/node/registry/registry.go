@@ -2,52 +2,254 @@ package registry
 
 import (
 	"context"
+	"maps"
+	"net/netip"
+	"slices"
 	"sort"
 	"sync"
 	"time"
 
+	"github.com/fabiant7t/exips/internal/metrics"
 	"github.com/fabiant7t/exips/internal/node"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 )
 
+// ReasonInvalidAnnotation of the Events recorded on nodes with invalid
+// annotations.
+const ReasonInvalidAnnotation = "InvalidAnnotation"
+
 type Registry struct {
 	mu   sync.RWMutex
 	repo map[string]node.Node
+
+	labelSelector labels.Selector
+	fieldSelector fields.Selector
+
+	pods         map[string]podState // by namespace/name
+	podNamespace string
+	podSelector  labels.Selector // nil unless pods are tracked
+
+	addressFilter node.AddressFilter
+	addressTypes  []corev1.NodeAddressType
+	resolver      node.Resolver
+	resolved      map[string]map[string][]netip.Addr // IPs of the address names by node name
+	resolveQueue  workqueue.TypedInterface[string]   // nil unless running with a resolver
+	recorder      record.EventRecorder               // nil if events are not recorded
+	invalid       map[string]*corev1.Node            // nodes with invalid annotations by name
+	reporting     bool                               // true while ReportAnnotations runs
+	staticIPs     []StaticIP
+
+	subscribers []func()
+
+	synced chan struct{} // closed once the informer caches have synced
+}
+
+// Option configures a Registry.
+type Option func(*Registry)
+
+// WithNodeSelector limits the registry to nodes matching the label and field
+// selectors. Nodes that do not match are never tracked.
+func WithNodeSelector(labelSelector labels.Selector, fieldSelector fields.Selector) Option {
+	return func(r *Registry) {
+		r.labelSelector = labelSelector
+		r.fieldSelector = fieldSelector
+	}
+}
+
+// WithAddressFilter sets the filter deciding which node addresses are public.
+func WithAddressFilter(f node.AddressFilter) Option {
+	return func(r *Registry) {
+		r.addressFilter = f
+	}
+}
+
+// WithAddressTypes sets the node address types in order of precedence,
+// node.DefaultAddressTypes if empty.
+func WithAddressTypes(addressTypes []corev1.NodeAddressType) Option {
+	return func(r *Registry) {
+		r.addressTypes = addressTypes
+	}
+}
+
+// WithResolver resolves the names of Hostname, ExternalDNS and InternalDNS
+// node addresses, which are ignored otherwise. Names are resolved in the
+// background after every add and update of a node.
+func WithResolver(resolver node.Resolver) Option {
+	return func(r *Registry) {
+		r.resolver = resolver
+	}
+}
+
+// WithEventRecorder records warning Events on nodes with invalid exips.io
+// annotations while ReportAnnotations runs.
+func WithEventRecorder(recorder record.EventRecorder) Option {
+	return func(r *Registry) {
+		r.recorder = recorder
+	}
+}
+
+// WithStaticIPs publishes the static IPs next to the IPs of the nodes.
+func WithStaticIPs(staticIPs []StaticIP) Option {
+	return func(r *Registry) {
+		r.staticIPs = staticIPs
+	}
 }
 
 // New creates and returns a node registry.
 // Call the `Run` method in a goroutine to start syncing cluster state.
-func New() *Registry {
+func New(opts ...Option) *Registry {
 	r := &Registry{
-		repo: make(map[string]node.Node),
+		repo:          make(map[string]node.Node),
+		pods:          make(map[string]podState),
+		invalid:       make(map[string]*corev1.Node),
+		resolved:      make(map[string]map[string][]netip.Addr),
+		synced:        make(chan struct{}),
+		labelSelector: labels.Everything(),
+		fieldSelector: fields.Everything(),
+	}
+	for _, opt := range opts {
+		opt(r)
 	}
 	return r
 }
 
-func (r *Registry) add(n node.Node) {
+// Subscribe registers fn to be called after every change of the registry.
+// fn must not block.
+func (r *Registry) Subscribe(fn func()) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// notify calls the subscribers. It must not be called while holding the lock.
+func (r *Registry) notify() {
+	r.mu.RLock()
+	subscribers := r.subscribers
+	r.mu.RUnlock()
+
+	for _, fn := range subscribers {
+		fn()
+	}
+}
+
+// newNode applies the address settings of the registry and the IPs its
+// address names resolved to, if any, to the node.
+func (r *Registry) newNode(n *corev1.Node, resolved map[string][]netip.Addr) node.Node {
+	v := node.New(n).
+		WithAddressFilter(r.addressFilter).
+		WithAddressTypes(r.addressTypes)
+	if r.resolver != nil {
+		v.WithResolved(resolved)
+	}
+	return v
+}
+
+// ReportAnnotations records a warning Event on the nodes with invalid exips.io
+// annotations until the context is done, first for all of them and then
+// whenever the annotations of a node change. Run it on the leader only, so
+// replicas do not record the same Events.
+func (r *Registry) ReportAnnotations(ctx context.Context) error {
+	if err := r.WaitForSync(ctx); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.reporting = true
+	nodes := slices.Collect(maps.Values(r.invalid))
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.reporting = false
+		r.mu.Unlock()
+	}()
+
+	for _, n := range nodes {
+		r.reportAnnotations(n, r.annotationErrors(n))
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// trackAnnotations remembers whether the node has invalid annotations, and
+// reports them if they changed while reporting.
+func (r *Registry) trackAnnotations(n *corev1.Node, changed bool) {
+	if r.recorder == nil {
+		return
+	}
+	errs := r.annotationErrors(n)
+	r.mu.Lock()
+	if len(errs) > 0 {
+		r.invalid[n.Name] = n
+	} else {
+		delete(r.invalid, n.Name)
+	}
+	report := r.reporting && changed
+	r.mu.Unlock()
+
+	if report {
+		r.reportAnnotations(n, errs)
+	}
+}
+
+// untrackAnnotations forgets the deleted node.
+func (r *Registry) untrackAnnotations(n *corev1.Node) {
+	r.mu.Lock()
+	delete(r.invalid, n.Name)
+	r.mu.Unlock()
+}
+
+// annotationErrors returns an error for every invalid annotation of the node,
+// including overridden IPs the address filter rejects.
+func (r *Registry) annotationErrors(n *corev1.Node) []error {
+	overrides, errs := node.ParseOverrides(n.Annotations)
+	_, rejected := overrides.Filter(r.addressFilter)
+	return append(errs, rejected...)
+}
+
+// reportAnnotations records a warning Event on the node for every error.
+func (r *Registry) reportAnnotations(n *corev1.Node, errs []error) {
+	for _, err := range errs {
+		r.recorder.Event(n, corev1.EventTypeWarning, ReasonInvalidAnnotation, err.Error())
+	}
+}
+
+func (r *Registry) add(n node.Node) {
+	r.mu.Lock()
 	r.repo[n.Name()] = n
+	r.mu.Unlock()
+
+	r.notify()
 }
 
 func (r *Registry) delete(n node.Node) {
 	r.mu.Lock()
-	defer r.mu.Unlock()
-
 	delete(r.repo, n.Name())
+	r.mu.Unlock()
+
+	r.notify()
 }
 
-// update assumes name is a stable identifier and never changes.
-func (r *Registry) update(_, new node.Node) {
+// set adds or updates the node with the IPs its address names resolved to
+// last, and schedules resolving them again.
+func (r *Registry) set(n *corev1.Node) {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	r.repo[n.Name] = r.newNode(n, r.resolved[n.Name])
+	queue := r.resolveQueue
+	r.mu.Unlock()
 
-	r.repo[new.Name()] = new
+	if queue != nil {
+		queue.Add(n.Name)
+	}
+	r.notify()
 }
 
 // Get looks up a node by name and returns the node and a boolean indicating
@@ -75,10 +277,41 @@ func (r *Registry) List() []node.Node {
 	return nodes
 }
 
-// Run
+// HasSynced returns true once the registry holds the complete cluster state.
+func (r *Registry) HasSynced() bool {
+	select {
+	case <-r.synced:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitForSync blocks until the registry has synced or the context is done,
+// returning the error of the context in the latter case.
+func (r *Registry) WaitForSync(ctx context.Context) error {
+	select {
+	case <-r.synced:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// Run syncs the nodes matching the node selectors, and the ingress controller
+// pods if configured, into the registry until the context is done. It must
+// only be called once.
 func (r *Registry) Run(ctx context.Context, client kubernetes.Interface, defaultResync time.Duration) error {
-	factory := informers.NewSharedInformerFactory(client, defaultResync)
+	factory := informers.NewSharedInformerFactoryWithOptions(client, defaultResync,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = r.labelSelector.String()
+			opts.FieldSelector = r.fieldSelector.String()
+		}),
+	)
 	nodeInformer := factory.Core().V1().Nodes().Informer()
+	if r.resolver != nil {
+		defer r.startResolving()()
+	}
 
 	_, err := nodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj any) {
@@ -86,7 +319,9 @@ func (r *Registry) Run(ctx context.Context, client kubernetes.Interface, default
 			if !ok || n == nil {
 				return
 			}
-			r.add(node.New(n))
+			metrics.RegistryEvents.WithLabelValues("node", "add").Inc()
+			r.trackAnnotations(n, true)
+			r.set(n)
 		},
 		DeleteFunc: func(obj any) {
 			var n *corev1.Node
@@ -105,6 +340,9 @@ func (r *Registry) Run(ctx context.Context, client kubernetes.Interface, default
 			if n == nil {
 				return
 			}
+			metrics.RegistryEvents.WithLabelValues("node", "delete").Inc()
+			r.untrackAnnotations(n)
+			r.forgetResolved(n.Name)
 			r.delete(node.New(n))
 		},
 		UpdateFunc: func(oldObj, newObj any) {
@@ -116,17 +354,36 @@ func (r *Registry) Run(ctx context.Context, client kubernetes.Interface, default
 			if !ok || newN == nil {
 				return
 			}
-			r.update(node.New(oldN), node.New(newN))
+			metrics.RegistryEvents.WithLabelValues("node", "update").Inc()
+			r.trackAnnotations(newN, !maps.Equal(oldN.Annotations, newN.Annotations))
+			r.set(newN)
 		},
 	})
 	if err != nil {
 		return err
 	}
 
+	hasSynced := []cache.InformerSynced{nodeInformer.HasSynced}
 	factory.Start(ctx.Done())
-	if !cache.WaitForCacheSync(ctx.Done(), nodeInformer.HasSynced) {
+
+	if r.podSelector != nil {
+		podFactory, podInformer, err := r.podInformer(client, defaultResync)
+		if err != nil {
+			return err
+		}
+		hasSynced = append(hasSynced, podInformer.HasSynced)
+		podFactory.Start(ctx.Done())
+	}
+
+	if !cache.WaitForCacheSync(ctx.Done(), hasSynced...) {
 		return ctx.Err()
 	}
+	if r.resolver != nil {
+		// the first reconcile must not miss nodes with names only
+		r.resolveAll(ctx, nodeInformer.GetIndexer())
+		go r.runResolver(ctx, nodeInformer.GetIndexer())
+	}
+	close(r.synced)
 
 	<-ctx.Done()
 	return ctx.Err()
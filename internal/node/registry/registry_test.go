@@ -1,10 +1,20 @@
 package registry
 
 import (
+	"context"
 	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/fabiant7t/exips/internal/node"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 )
 
 func TestAdd(t *testing.T) {
@@ -52,12 +62,16 @@ func TestGet(t *testing.T) {
 	}
 }
 
-func TestUpdate(t *testing.T) {
+func TestSet(t *testing.T) {
 	reg := New()
-	n := node.NewDummyNode("cp-1", true, true, true, nil)
-	reg.add(node.NewDummyNode("cp-1", true, true, true, nil))
-	nNotReady := node.NewDummyNode("cp-1", false, false, true, nil)
-	reg.update(n, nNotReady)
+	reg.set(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "cp-1"},
+		Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}},
+	})
+	reg.set(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "cp-1"},
+		Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionFalse}}},
+	})
 	nFromReg, ok := reg.Get("cp-1")
 	if got, want := ok, true; got != want {
 		t.Errorf("Got %t, want %t", got, want)
@@ -65,6 +79,9 @@ func TestUpdate(t *testing.T) {
 	if got, want := nFromReg.IsReady(), false; got != want {
 		t.Errorf("Got %t, want %t", got, want)
 	}
+	if got, want := len(reg.List()), 1; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
 }
 
 func TestList(t *testing.T) {
@@ -81,3 +98,124 @@ func TestList(t *testing.T) {
 		}
 	}
 }
+
+func TestRunWithNodeSelector(t *testing.T) {
+	client := fake.NewClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "w-1", Labels: map[string]string{"ingress": "true"}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "w-2"}},
+	)
+	reg := New(WithNodeSelector(labels.SelectorFromSet(labels.Set{"ingress": "true"}), fields.Everything()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reg.Run(ctx, client, 0)
+	if err := reg.WaitForSync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	nodes := reg.List()
+	if got, want := len(nodes), 1; got != want {
+		t.Fatalf("Got %d, want %d", got, want)
+	}
+	if got, want := nodes[0].Name(), "w-1"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+}
+
+func TestWaitForSync(t *testing.T) {
+	reg := New()
+	if got, want := reg.HasSynced(), false; got != want {
+		t.Errorf("Got %t, want %t", got, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reg.Run(ctx, fake.NewClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "w-1"}}), 0)
+	if err := reg.WaitForSync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reg.HasSynced(), true; got != want {
+		t.Errorf("Got %t, want %t", got, want)
+	}
+	if got, want := len(reg.List()), 1; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+}
+
+func TestReportAnnotations(t *testing.T) {
+	client := fake.NewClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "w-1", Annotations: map[string]string{node.AnnotationPublicIPv4: "2a01:4f8::1"}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "w-2", Annotations: map[string]string{node.AnnotationPublicIPv4: "1.2.3.4"}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "w-3", Annotations: map[string]string{node.AnnotationPublicIPv4: "10.0.0.1"}}},
+	)
+	recorder := record.NewFakeRecorder(10)
+	reg := New(WithEventRecorder(recorder))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reg.Run(ctx, client, 0)
+	if err := reg.WaitForSync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expectNoEvent := func() {
+		t.Helper()
+		select {
+		case event := <-recorder.Events:
+			t.Errorf("Got %s, want no event", event)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	expectEvents := func(n int) []string {
+		t.Helper()
+		var events []string
+		for range n {
+			select {
+			case event := <-recorder.Events:
+				events = append(events, event)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Got events %v, want %d", events, n)
+			}
+		}
+		slices.Sort(events)
+		return events
+	}
+	// replicas that do not lead record no events
+	expectNoEvent()
+
+	go reg.ReportAnnotations(ctx)
+	events := expectEvents(2)
+	for i, want := range []string{
+		"Warning " + ReasonInvalidAnnotation + " invalid annotation exips.io/public-ipv4: 10.0.0.1 is rejected: 10.0.0.0/8 (Private-Use)",
+		"Warning " + ReasonInvalidAnnotation + " invalid annotation exips.io/public-ipv4: 2a01:4f8::1 is not an IPv4 address",
+	} {
+		if got := events[i]; !strings.HasPrefix(got, want) {
+			t.Errorf("Got %s, want prefix %s", got, want)
+		}
+	}
+	expectNoEvent()
+
+	// updates without annotation changes record no events
+	w1, err := client.CoreV1().Nodes().Get(ctx, "w-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w1.Labels = map[string]string{"role": "worker"}
+	if _, err := client.CoreV1().Nodes().Update(ctx, w1, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectNoEvent()
+
+	w2, err := client.CoreV1().Nodes().Get(ctx, "w-2", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2.Annotations[node.AnnotationPublicIPv4] = "invalid"
+	if _, err := client.CoreV1().Nodes().Update(ctx, w2, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	events = expectEvents(1)
+	want := "Warning " + ReasonInvalidAnnotation + " invalid annotation exips.io/public-ipv4"
+	if got := events[0]; !strings.HasPrefix(got, want) {
+		t.Errorf("Got %s, want prefix %s", got, want)
+	}
+	expectNoEvent()
+}
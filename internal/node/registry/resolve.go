@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"net/netip"
+	"slices"
+
+	"github.com/fabiant7t/exips/internal/node"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// startResolving creates the queue of the nodes whose address names are to be
+// resolved, and returns a function shutting it down.
+func (r *Registry) startResolving() (stop func()) {
+	queue := workqueue.NewTypedWithConfig(workqueue.TypedQueueConfig[string]{Name: "exips-resolver"})
+	r.mu.Lock()
+	r.resolveQueue = queue
+	r.mu.Unlock()
+	return func() {
+		queue.ShutDown()
+		r.mu.Lock()
+		r.resolveQueue = nil
+		r.mu.Unlock()
+	}
+}
+
+// resolveAll resolves the address names of the queued nodes until the queue
+// is empty. It must not run next to runResolver.
+func (r *Registry) resolveAll(ctx context.Context, indexer cache.Indexer) {
+	r.mu.RLock()
+	queue := r.resolveQueue
+	r.mu.RUnlock()
+
+	for queue.Len() > 0 {
+		name, shutdown := queue.Get()
+		if shutdown {
+			return
+		}
+		r.resolve(ctx, indexer, name)
+		queue.Done(name)
+	}
+}
+
+// runResolver resolves the address names of the queued nodes until the queue
+// shuts down, so slow lookups never block the informer.
+func (r *Registry) runResolver(ctx context.Context, indexer cache.Indexer) {
+	r.mu.RLock()
+	queue := r.resolveQueue
+	r.mu.RUnlock()
+
+	for {
+		name, shutdown := queue.Get()
+		if shutdown {
+			return
+		}
+		r.resolve(ctx, indexer, name)
+		queue.Done(name)
+	}
+}
+
+// resolve resolves the address names of the node in the informer cache and
+// updates the node if their IPs changed. A name that fails to resolve keeps
+// the IPs of its last successful lookup, so a resolver error does not take
+// the node out.
+func (r *Registry) resolve(ctx context.Context, indexer cache.Indexer, name string) {
+	obj, ok, err := indexer.GetByKey(name)
+	if err != nil || !ok { // deleted
+		return
+	}
+	n, ok := obj.(*corev1.Node)
+	if !ok {
+		return
+	}
+	r.mu.RLock()
+	previous := r.resolved[name]
+	r.mu.RUnlock()
+
+	resolved := make(map[string][]netip.Addr)
+	for _, addr := range n.Status.Addresses {
+		if _, ok := resolved[addr.Address]; ok || !node.IsNameAddressType(addr.Type) {
+			continue
+		}
+		ips, err := node.Resolve(ctx, r.resolver, addr.Address)
+		if err != nil {
+			slog.Warn("error resolving node address, keeping the previous IPs", "node", name, "addr", addr.Address, "ips", previous[addr.Address], "err", err)
+			ips = previous[addr.Address]
+		}
+		resolved[addr.Address] = ips
+	}
+	if maps.EqualFunc(previous, resolved, slices.Equal) {
+		return
+	}
+
+	r.mu.Lock()
+	_, tracked := r.repo[name]
+	if tracked {
+		r.resolved[name] = resolved
+		// the node may have been updated during the lookup, which set
+		// resolves again
+		if obj, ok, err := indexer.GetByKey(name); err == nil && ok {
+			if latest, ok := obj.(*corev1.Node); ok {
+				n = latest
+			}
+		}
+		r.repo[name] = r.newNode(n, resolved)
+	}
+	r.mu.Unlock()
+
+	if tracked {
+		slog.Debug("node address names resolved", "node", name, "ips", resolved)
+		r.notify()
+	}
+}
+
+// forgetResolved forgets the IPs of the address names of the deleted node.
+func (r *Registry) forgetResolved(name string) {
+	r.mu.Lock()
+	delete(r.resolved, name)
+	r.mu.Unlock()
+}
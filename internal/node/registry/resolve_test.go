@@ -0,0 +1,219 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testResolver answers with the IPs of the names, fails for names without
+// any, and blocks for names that are held. Lookups of held names are sent to
+// looked, if set.
+type testResolver struct {
+	mu     sync.Mutex
+	ips    map[string][]netip.Addr
+	held   map[string]chan struct{}
+	looked chan string
+}
+
+func (r *testResolver) LookupNetIP(ctx context.Context, _, host string) ([]netip.Addr, error) {
+	r.mu.Lock()
+	held, looked := r.held[host], r.looked
+	r.mu.Unlock()
+	if held != nil && looked != nil {
+		looked <- host
+	}
+	if held != nil {
+		select {
+		case <-held:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ips, ok := r.ips[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return slices.Clone(ips), nil
+}
+
+func (r *testResolver) set(host string, ips ...netip.Addr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(ips) == 0 {
+		delete(r.ips, host)
+	} else {
+		r.ips[host] = ips
+	}
+}
+
+// hold blocks the lookups of the host until the returned function is called.
+func (r *testResolver) hold(host string) (release func()) {
+	ch := make(chan struct{})
+	r.mu.Lock()
+	r.held[host] = ch
+	r.mu.Unlock()
+	return func() {
+		r.mu.Lock()
+		delete(r.held, host)
+		r.mu.Unlock()
+		close(ch)
+	}
+}
+
+func dnsNode(name, host string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeExternalDNS, Address: host}},
+		},
+	}
+}
+
+// waitForPublicIPs polls the node until it has the wanted public IPs.
+func waitForPublicIPs(t *testing.T, reg *Registry, name string, want []netip.Addr) {
+	t.Helper()
+	var got []netip.Addr
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if n, ok := reg.Get(name); ok {
+			got = n.PublicIPsByType([]corev1.NodeAddressType{corev1.NodeExternalDNS})
+			if slices.Equal(got, want) {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s: Got %v, want %v", name, got, want)
+}
+
+func TestRunResolvesNames(t *testing.T) {
+	ip1, ip2 := netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2.3.4.5")
+	resolver := &testResolver{
+		ips:    map[string][]netip.Addr{"w-1.example.com": {ip1}},
+		held:   make(map[string]chan struct{}),
+		looked: make(chan string, 1),
+	}
+	client := fake.NewClientset(dnsNode("w-1", "w-1.example.com"))
+	reg := New(WithResolver(resolver))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reg.Run(ctx, client, 0)
+	if err := reg.WaitForSync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// resolved before the registry syncs
+	n, _ := reg.Get("w-1")
+	if got, want := n.PublicIPsByType([]corev1.NodeAddressType{corev1.NodeExternalDNS}), []netip.Addr{ip1}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+
+	// a slow lookup does not hold up other nodes
+	release := resolver.hold("slow.example.com")
+	if _, err := client.CoreV1().Nodes().Create(ctx, dnsNode("slow", "slow.example.com"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	<-resolver.looked
+	if _, err := client.CoreV1().Nodes().Create(ctx, dnsNode("w-2", "w-2.example.com"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for _, ok := reg.Get("w-2"); !ok; _, ok = reg.Get("w-2") {
+		if time.Now().After(deadline) {
+			t.Fatal("Got no w-2")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	release()
+
+	// a failed lookup keeps the previous IPs
+	resolver.set("w-1.example.com")
+	update := func() {
+		t.Helper()
+		n, err := client.CoreV1().Nodes().Get(ctx, "w-1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.Labels = map[string]string{"updated": time.Now().Format(time.RFC3339Nano)}
+		if _, err := client.CoreV1().Nodes().Update(ctx, n, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	release = resolver.hold("w-1.example.com")
+	update()
+	<-resolver.looked
+	release()
+	// lookups run one at a time, so the failed one is done once the next
+	// one started
+	release = resolver.hold("w-1.example.com")
+	update()
+	<-resolver.looked
+	n, _ = reg.Get("w-1")
+	if got, want := n.PublicIPsByType([]corev1.NodeAddressType{corev1.NodeExternalDNS}), []netip.Addr{ip1}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+
+	// a changed answer is picked up with the next update
+	resolver.set("w-1.example.com", ip2)
+	release()
+	waitForPublicIPs(t, reg, "w-1", []netip.Addr{ip2})
+}
+
+func TestResolveKeepsUpdatesDuringLookups(t *testing.T) {
+	ip1, ip2 := netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2.3.4.5")
+	resolver := &testResolver{
+		ips:    map[string][]netip.Addr{"w-1.example.com": {ip1}},
+		held:   make(map[string]chan struct{}),
+		looked: make(chan string, 1),
+	}
+	client := fake.NewClientset(dnsNode("w-1", "w-1.example.com"))
+	reg := New(WithResolver(resolver))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reg.Run(ctx, client, 0)
+	if err := reg.WaitForSync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	label := func(version string) {
+		t.Helper()
+		n, err := client.CoreV1().Nodes().Get(ctx, "w-1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.Labels = map[string]string{"version": version}
+		if _, err := client.CoreV1().Nodes().Update(ctx, n, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	release := resolver.hold("w-1.example.com")
+	resolver.set("w-1.example.com", ip2)
+	label("1")
+	<-resolver.looked
+	// updated while the lookup of version 1 is held
+	label("2")
+	deadline := time.Now().Add(5 * time.Second)
+	for n, _ := reg.Get("w-1"); n.Labels()["version"] != "2"; n, _ = reg.Get("w-1") {
+		if time.Now().After(deadline) {
+			t.Fatal("Got no version 2")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	release()
+
+	waitForPublicIPs(t, reg, "w-1", []netip.Addr{ip2})
+	n, _ := reg.Get("w-1")
+	if got, want := n.Labels()["version"], "2"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+}
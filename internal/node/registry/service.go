@@ -1,29 +1,50 @@
 package registry
 
 import (
+	"log/slog"
 	"net/netip"
+
+	"github.com/fabiant7t/exips/internal/node"
+
+	corev1 "k8s.io/api/core/v1"
 )
 
-// ParseExternalIPs returns the public IPs of all ready and schedulable nodes,
-// excluding control-plane nodes tainted with
-// node-role.kubernetes.io/control-plane:NoSchedule.
-func (r *Registry) ParseExternalIPs() []netip.Addr {
+// Evaluation is the eligibility verdict for a node.
+type Evaluation struct {
+	Node    node.Node
+	Verdict node.Verdict
+}
+
+// Evaluate returns the eligibility verdicts of all nodes, ordered by node
+// name ascending.
+func (r *Registry) Evaluate(eligibility node.Eligibility) []Evaluation {
 	nodes := r.List() // already ordered
-	ips := make([]netip.Addr, 0, len(nodes))
-	for _, n := range nodes {
-		if !n.IsReady() {
-			continue
-		}
-		if !n.IsSchedulable() {
-			continue
-		}
-		if !n.IsControlPlaneSchedulable() {
+	evaluations := make([]Evaluation, len(nodes))
+	for i, n := range nodes {
+		evaluations[i] = Evaluation{Node: n, Verdict: eligibility.Evaluate(n)}
+	}
+	return evaluations
+}
+
+// ParseExternalIPs returns the public IPs of all nodes that are eligible,
+// followed by the static IPs. The family policy decides which of the public
+// IPs of a node are included.
+func (r *Registry) ParseExternalIPs(eligibility node.Eligibility, policy node.FamilyPolicy) []netip.Addr {
+	evaluations := r.Evaluate(eligibility)
+	return MergeIPs(PublicIPs(evaluations, policy, nil), StaticIPs(evaluations, policy, r.staticIPs)...)
+}
+
+// PublicIPs returns the public IPs of the eligible nodes of the evaluations.
+// The address types decide which node addresses take precedence, the address
+// types of the nodes if empty.
+func PublicIPs(evaluations []Evaluation, policy node.FamilyPolicy, addressTypes []corev1.NodeAddressType) []netip.Addr {
+	ips := make([]netip.Addr, 0, len(evaluations))
+	for _, e := range evaluations {
+		if !e.Verdict.Eligible {
+			slog.Debug("node excluded", "node", e.Node.Name(), "reason", e.Verdict.Reason, "message", e.Verdict.Message)
 			continue
 		}
-		pubIP, err := n.PublicIP()
-		if err == nil {
-			ips = append(ips, pubIP)
-		}
+		ips = append(ips, policy.Select(e.Node.PublicIPsByType(addressTypes))...)
 	}
 	return ips
 }
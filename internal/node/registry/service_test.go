@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/fabiant7t/exips/internal/node"
+
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 func TestParseExternalIPs(t *testing.T) {
@@ -25,7 +27,7 @@ func TestParseExternalIPs(t *testing.T) {
 	// w-2 is ready, schedulable and has a public IP
 	reg.add(node.NewDummyNode("w-2", true, true, true, ptr(netip.MustParseAddr("5.6.7.8"))))
 
-	got := reg.ParseExternalIPs()
+	got := reg.ParseExternalIPs(node.DefaultEligibility(), node.DefaultFamilyPolicy)
 	want := []netip.Addr{
 		netip.MustParseAddr("3.2.1.0"),
 		netip.MustParseAddr("5.6.7.8"),
@@ -35,6 +37,66 @@ func TestParseExternalIPs(t *testing.T) {
 	}
 }
 
+func TestParseExternalIPsFamilyPolicy(t *testing.T) {
+	reg := New()
+	// ds-1 is ready, schedulable and dual-stack
+	reg.add(node.NewDualStackDummyNode("ds-1", true, true, true, netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2001:db8::1")))
+	// v4-1 is ready, schedulable and IPv4 only
+	reg.add(node.NewDualStackDummyNode("v4-1", true, true, true, netip.MustParseAddr("5.6.7.8")))
+	// v6-1 is ready, schedulable and IPv6 only
+	reg.add(node.NewDualStackDummyNode("v6-1", true, true, true, netip.MustParseAddr("2001:db8::2")))
+
+	for _, tc := range []struct {
+		policy node.FamilyPolicy
+		want   []string
+	}{
+		{policy: node.FamilyPolicyIPv4Only, want: []string{"1.2.3.4", "5.6.7.8"}},
+		{policy: node.FamilyPolicyIPv6Only, want: []string{"2001:db8::1", "2001:db8::2"}},
+		{policy: node.FamilyPolicyDualStack, want: []string{"1.2.3.4", "2001:db8::1", "5.6.7.8", "2001:db8::2"}},
+		{policy: node.FamilyPolicyPreferIPv4, want: []string{"1.2.3.4", "5.6.7.8", "2001:db8::2"}},
+		{policy: node.FamilyPolicyPreferIPv6, want: []string{"2001:db8::1", "5.6.7.8", "2001:db8::2"}},
+	} {
+		got := reg.ParseExternalIPs(node.DefaultEligibility(), tc.policy)
+		want := make([]netip.Addr, len(tc.want))
+		for i, s := range tc.want {
+			want[i] = netip.MustParseAddr(s)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Got %+v, want %+v", tc.policy, got, want)
+		}
+	}
+}
+
 func ptr(a netip.Addr) *netip.Addr {
 	return &a
 }
+
+func TestEvaluate(t *testing.T) {
+	reg := New()
+	reg.add(node.NewDummyNode("cp-1", true, true, false, ptr(netip.MustParseAddr("1.2.3.4"))))
+	reg.add(node.NewDummyNode("w-1", false, true, true, ptr(netip.MustParseAddr("2.3.4.5"))))
+	reg.add(node.NewDummyNode("w-2", true, true, true, ptr(netip.MustParseAddr("3.4.5.6"))).WithLabels(map[string]string{"ingress": "true"}))
+	reg.add(node.NewDummyNode("w-3", true, true, true, ptr(netip.MustParseAddr("4.5.6.7"))))
+
+	eligibility := node.All(
+		node.DefaultEligibility(),
+		node.RequireLabels(labels.SelectorFromSet(labels.Set{"ingress": "true"})),
+	)
+	got := make(map[string]string)
+	for _, e := range reg.Evaluate(eligibility) {
+		got[e.Node.Name()] = e.Verdict.Reason
+	}
+	want := map[string]string{
+		"cp-1": node.ReasonTainted,
+		"w-1":  node.ReasonNotReady,
+		"w-2":  "",
+		"w-3":  node.ReasonLabelMismatch,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+
+	if got, want := reg.ParseExternalIPs(eligibility, node.DefaultFamilyPolicy), []netip.Addr{netip.MustParseAddr("3.4.5.6")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+}
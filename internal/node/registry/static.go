@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/fabiant7t/exips/internal/node"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// StaticIP is published next to the IPs of the nodes, e.g. a keepalived VIP
+// or a floating IP of the provider.
+type StaticIP struct {
+	IP netip.Addr
+	// NodeSelector binds the IP to the nodes holding it, so it is only
+	// published while one of them is eligible. Always published if nil.
+	NodeSelector labels.Selector
+}
+
+func (s StaticIP) String() string {
+	if s.NodeSelector == nil {
+		return s.IP.String()
+	}
+	return s.IP.String() + "@" + s.NodeSelector.String()
+}
+
+// ParseStaticIPs parses a comma separated list of static IPs in the form
+// ip[@selector], the selector being a single label requirement, e.g.
+// 203.0.113.10 or 198.51.100.7@keepalived=master.
+func ParseStaticIPs(s string) ([]StaticIP, error) {
+	var staticIPs []StaticIP
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		addr, selector, bound := strings.Cut(item, "@")
+		ip, err := netip.ParseAddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid static IP %q: %w", item, err)
+		}
+		staticIP := StaticIP{IP: ip.Unmap()}
+		if bound {
+			sel, err := labels.Parse(selector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid node selector of static IP %q: %w", item, err)
+			}
+			if sel.Empty() {
+				return nil, fmt.Errorf("invalid static IP %q: empty node selector", item)
+			}
+			staticIP.NodeSelector = sel
+		}
+		staticIPs = append(staticIPs, staticIP)
+	}
+	return staticIPs, nil
+}
+
+// StaticIPs returns the static IPs of the family policy that are unbound or
+// bound to an eligible node of the evaluations.
+func StaticIPs(evaluations []Evaluation, policy node.FamilyPolicy, staticIPs []StaticIP) []netip.Addr {
+	var ips []netip.Addr
+	for _, s := range staticIPs {
+		if !policy.Allows(s.IP) {
+			continue
+		}
+		if s.NodeSelector == nil || slices.ContainsFunc(evaluations, func(e Evaluation) bool {
+			return e.Verdict.Eligible && s.NodeSelector.Matches(labels.Set(e.Node.Labels()))
+		}) {
+			ips = append(ips, s.IP)
+		}
+	}
+	return ips
+}
+
+// MergeIPs appends the IPs not in ips yet.
+func MergeIPs(ips []netip.Addr, more ...netip.Addr) []netip.Addr {
+	for _, ip := range more {
+		if !slices.Contains(ips, ip) {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
@@ -0,0 +1,54 @@
+package registry
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/fabiant7t/exips/internal/node"
+)
+
+func TestParseStaticIPs(t *testing.T) {
+	got, err := ParseStaticIPs("203.0.113.10, 198.51.100.7@keepalived=master,2a01:4f8::1@vip,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(got), 3; got != want {
+		t.Fatalf("Got %d, want %d", got, want)
+	}
+	for i, want := range []string{"203.0.113.10", "198.51.100.7@keepalived=master", "2a01:4f8::1@vip"} {
+		if got := got[i].String(); got != want {
+			t.Errorf("Got %s, want %s", got, want)
+		}
+	}
+	for _, s := range []string{"203.0.113", "203.0.113.10@", "203.0.113.10@a=b=c"} {
+		if _, err := ParseStaticIPs(s); err == nil {
+			t.Errorf("%s: Got no error, want error", s)
+		}
+	}
+}
+
+func TestParseExternalIPsStaticIPs(t *testing.T) {
+	staticIPs, err := ParseStaticIPs("203.0.113.10,198.51.100.7@keepalived=master,2a01:4f8::1,1.2.3.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := New(WithStaticIPs(staticIPs))
+	reg.add(node.NewDummyNode("w-1", true, true, true, ptr(netip.MustParseAddr("1.2.3.4"))))
+	// w-2 holds the VIP, but is not ready
+	reg.add(node.NewDummyNode("w-2", false, true, true, ptr(netip.MustParseAddr("2.3.4.5"))).WithLabels(map[string]string{"keepalived": "master"}))
+
+	got := reg.ParseExternalIPs(node.DefaultEligibility(), node.DefaultFamilyPolicy)
+	want := []netip.Addr{netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("203.0.113.10"), netip.MustParseAddr("2a01:4f8::1")}
+	if !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+
+	// the VIP follows w-2 once it is ready
+	reg.add(node.NewDummyNode("w-2", true, true, true, ptr(netip.MustParseAddr("2.3.4.5"))).WithLabels(map[string]string{"keepalived": "master"}))
+	got = reg.ParseExternalIPs(node.DefaultEligibility(), node.FamilyPolicyIPv4Only)
+	want = []netip.Addr{netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2.3.4.5"), netip.MustParseAddr("203.0.113.10"), netip.MustParseAddr("198.51.100.7")}
+	if !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,613 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fabiant7t/exips/internal/metrics"
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/node/registry"
+	"github.com/fabiant7t/exips/internal/service"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// ErrNotSynced is returned when reconciling before the registry has synced.
+var ErrNotSynced = errors.New("error: registry has not synced")
+
+// ErrForeignService is returned when publishing on a Service of another
+// owner, which exips must not take over.
+var ErrForeignService = errors.New("error: Service is not managed by exips")
+
+// Target is a Service whose external IPs are kept in sync with the eligible
+// nodes.
+type Target struct {
+	// Name and Namespace of the Service
+	Name      string
+	Namespace string
+	// Eligibility decides which nodes are published
+	Eligibility node.Eligibility
+	// FamilyPolicy decides which IP families of a node are published
+	FamilyPolicy node.FamilyPolicy
+	// AddressTypes decide which node addresses take precedence, the address
+	// types of the nodes if empty
+	AddressTypes []corev1.NodeAddressType
+	// StaticIPs are published next to the IPs of the nodes
+	StaticIPs []registry.StaticIP
+	// Ports of the Service, service.DefaultPorts if empty
+	Ports []corev1.ServicePort
+	// Type of the Service: ClusterIP (or empty) publishes the IPs as external
+	// IPs, LoadBalancer in the load balancer status
+	Type corev1.ServiceType
+	// Owner of the Service, if any, so it is garbage collected with it
+	Owner *metav1.OwnerReference
+	// Endpoints decides which node addresses are listed in the
+	// EndpointSlices of the Service, none if empty
+	Endpoints service.EndpointAddresses
+	// Sinks get the IPs once the Service publishes them, e.g. DNS records.
+	// They are retried on their own, a failing sink never fails the reconcile
+	// of the Service.
+	Sinks []Sink
+}
+
+// Sink publishes the IPs of a target outside of the cluster.
+type Sink interface {
+	Publish(ctx context.Context, ips []string) error
+}
+
+// Key identifies the target in the work queue, logs and metrics.
+func (t Target) Key() string {
+	return t.Namespace + "/" + t.Name
+}
+
+// Config of the Reconciler.
+type Config struct {
+	// Targets are the Services to reconcile
+	Targets []Target
+	// Debounce is the delay between a change and the reconcile, so bursts of
+	// changes result in a single reconcile
+	Debounce time.Duration
+	// Interval of the safety resync
+	Interval time.Duration
+	// RetryBaseDelay is the delay before the first retry, doubling with every
+	// further retry up to RetryMaxDelay
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// MaxRetries of a failing reconcile before giving up, 0 retries forever
+	MaxRetries int
+}
+
+// retryJitterFactor adds up to 20% to every retry delay, so replicas and
+// targets do not retry in lockstep.
+const retryJitterFactor = 0.2
+
+// Reconciler keeps the external IPs of the target Services in sync with the
+// eligible nodes of the registry.
+type Reconciler struct {
+	client  kubernetes.Interface
+	reg     *registry.Registry
+	cfg     Config
+	targets map[string]Target // by key
+
+	mu          sync.Mutex
+	queue       workqueue.TypedRateLimitingInterface[string] // nil unless running
+	sinkQueue   workqueue.TypedRateLimitingInterface[string] // nil unless running
+	lastActive  time.Time
+	lastSuccess map[string]time.Time // by key
+	lastError   map[string]error     // by key, nil after a success
+	published   map[string][]string  // by key
+}
+
+// TargetStatus is the state of the Service of a target.
+type TargetStatus struct {
+	Name      string             `json:"name"`
+	Namespace string             `json:"namespace"`
+	Type      corev1.ServiceType `json:"type,omitempty"`
+	// PublishedIPs of the last successful reconcile
+	PublishedIPs []string `json:"publishedIPs"`
+	// LastSuccess is the time of the last successful reconcile, nil if there
+	// was none
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	// LastError of the last reconcile, empty if it succeeded
+	LastError string `json:"lastError,omitempty"`
+}
+
+// New creates a Reconciler for the configured targets. It fails if two
+// targets share the same Service.
+func New(client kubernetes.Interface, reg *registry.Registry, cfg Config) (*Reconciler, error) {
+	targets := make(map[string]Target, len(cfg.Targets))
+	for _, t := range cfg.Targets {
+		if _, ok := targets[t.Key()]; ok {
+			return nil, fmt.Errorf("error: duplicate target service %s", t.Key())
+		}
+		targets[t.Key()] = t
+	}
+	r := &Reconciler{
+		client:      client,
+		reg:         reg,
+		cfg:         cfg,
+		targets:     targets,
+		lastSuccess: make(map[string]time.Time, len(targets)),
+		lastError:   make(map[string]error, len(targets)),
+		published:   make(map[string][]string, len(targets)),
+	}
+	reg.Subscribe(r.Trigger)
+	return r, nil
+}
+
+// Trigger schedules a reconcile of all targets after the debounce duration.
+// It does nothing unless the reconciler is running.
+func (r *Reconciler) Trigger() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.queue != nil {
+		for key := range r.targets {
+			r.queue.AddAfter(key, r.cfg.Debounce)
+		}
+	}
+}
+
+// trigger schedules a reconcile of a single target after the debounce
+// duration.
+func (r *Reconciler) trigger(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.queue != nil {
+		r.queue.AddAfter(key, r.cfg.Debounce)
+	}
+}
+
+// Running returns true while Run is reconciling, i.e. while this replica is
+// the leader.
+func (r *Reconciler) Running() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.queue != nil
+}
+
+// LastActive returns the time Run last made progress: it started, the
+// registry synced or a reconcile finished, successful or not.
+func (r *Reconciler) LastActive() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lastActive
+}
+
+func (r *Reconciler) active() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastActive = time.Now()
+}
+
+// LastSuccess returns the time the least recently reconciled target was last
+// reconciled successfully, the zero time if any target never was. Without
+// targets, there is nothing to fail and it is the time Run last made progress.
+func (r *Reconciler) LastSuccess() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.targets) == 0 {
+		return r.lastActive
+	}
+	var oldest time.Time
+	for key := range r.targets {
+		t, ok := r.lastSuccess[key]
+		if !ok {
+			return time.Time{}
+		}
+		if oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+	return oldest
+}
+
+// Targets returns the state of the targets, ordered by key. Only a running
+// reconciler has reconciled them.
+func (r *Reconciler) Targets() []TargetStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := slices.Sorted(maps.Keys(r.targets))
+	statuses := make([]TargetStatus, len(keys))
+	for i, key := range keys {
+		t := r.targets[key]
+		statuses[i] = TargetStatus{
+			Name:         t.Name,
+			Namespace:    t.Namespace,
+			Type:         t.Type,
+			PublishedIPs: r.published[key],
+		}
+		if last, ok := r.lastSuccess[key]; ok {
+			statuses[i].LastSuccess = &last
+		}
+		if err := r.lastError[key]; err != nil {
+			statuses[i].LastError = err.Error()
+		}
+	}
+	return statuses
+}
+
+// Run reconciles the targets whenever the registry or a Service changes, and
+// every interval, until the context is done. Failed reconciles are retried
+// with exponential backoff. Run returns an error if a reconcile fails for a
+// reason retrying cannot fix, or too many times in a row.
+func (r *Reconciler) Run(ctx context.Context) error {
+	queue := workqueue.NewTypedRateLimitingQueueWithConfig(
+		newBackoff(r.cfg.RetryBaseDelay, r.cfg.RetryMaxDelay, retryJitterFactor),
+		workqueue.TypedRateLimitingQueueConfig[string]{Name: "exips"},
+	)
+	sinkQueue := workqueue.NewTypedRateLimitingQueueWithConfig(
+		newBackoff(r.cfg.RetryBaseDelay, r.cfg.RetryMaxDelay, retryJitterFactor),
+		workqueue.TypedRateLimitingQueueConfig[string]{Name: "exips-sinks"},
+	)
+	r.mu.Lock()
+	r.queue = queue
+	r.sinkQueue = sinkQueue
+	r.lastActive = time.Now()
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.queue = nil
+		r.sinkQueue = nil
+		r.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	var factories []informers.SharedInformerFactory
+	defer func() { // also when giving up
+		cancel()
+		for _, factory := range factories {
+			factory.Shutdown()
+		}
+	}()
+	for key, t := range r.targets {
+		factory, err := r.serviceInformer(key, t)
+		if err != nil {
+			return err
+		}
+		factory.Start(ctx.Done())
+		factories = append(factories, factory)
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				queue.ShutDown()
+				sinkQueue.ShutDown()
+				return
+			case <-ticker.C:
+				for key := range r.targets {
+					queue.Add(key)
+				}
+			}
+		}
+	}()
+
+	// an empty registry would wipe all external IPs
+	if err := r.reg.WaitForSync(ctx); err != nil {
+		return err
+	}
+	r.active()
+	go r.runSinks(ctx, sinkQueue)
+	for key := range r.targets {
+		queue.Add(key)
+	}
+	for {
+		key, shutdown := queue.Get()
+		if shutdown {
+			return ctx.Err()
+		}
+		if err := r.handle(ctx, queue, key); err != nil {
+			return err
+		}
+	}
+}
+
+// serviceInformer watches the Service of the target, so manual edits and
+// deletion are corrected right away.
+func (r *Reconciler) serviceInformer(key string, t Target) (informers.SharedInformerFactory, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(r.client, r.cfg.Interval,
+		informers.WithNamespace(t.Namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", t.Name).String()
+		}),
+	)
+	_, err := factory.Core().V1().Services().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj any) {
+			oldSvc, ok := oldObj.(*corev1.Service)
+			if !ok {
+				return
+			}
+			newSvc, ok := newObj.(*corev1.Service)
+			if !ok || newSvc.ResourceVersion == oldSvc.ResourceVersion { // periodic resync
+				return
+			}
+			r.trigger(key)
+		},
+		DeleteFunc: func(any) {
+			r.trigger(key)
+		},
+	})
+	return factory, err
+}
+
+// handle reconciles and decides whether and when to retry.
+func (r *Reconciler) handle(ctx context.Context, queue workqueue.TypedRateLimitingInterface[string], key string) error {
+	defer queue.Done(key)
+
+	t, ok := r.targets[key]
+	if !ok {
+		queue.Forget(key)
+		return nil
+	}
+	metrics.ReconcileAttempts.WithLabelValues(key).Inc()
+	err := r.Reconcile(ctx, t)
+	if err == nil {
+		metrics.ReconcileSuccesses.WithLabelValues(key).Inc()
+		metrics.LastSuccessfulReconcile.WithLabelValues(key).SetToCurrentTime()
+	} else {
+		metrics.ReconcileFailures.WithLabelValues(key).Inc()
+	}
+	r.mu.Lock()
+	r.lastActive = time.Now()
+	if err == nil {
+		r.lastSuccess[key] = r.lastActive
+	}
+	r.lastError[key] = err
+	r.mu.Unlock()
+
+	switch {
+	case err == nil:
+		queue.Forget(key)
+		return nil
+	case ctx.Err() != nil: // shutting down
+		return nil
+	case !IsRetryable(err):
+		return fmt.Errorf("error reconciling service %s: %w", key, err)
+	case r.cfg.MaxRetries > 0 && queue.NumRequeues(key) >= r.cfg.MaxRetries:
+		return fmt.Errorf("error reconciling service %s, giving up after %d retries: %w", key, r.cfg.MaxRetries, err)
+	}
+	slog.Error("error reconciling service, will retry", "err", err, "name", t.Name, "namespace", t.Namespace, "retries", queue.NumRequeues(key))
+	queue.AddRateLimited(key)
+	return nil
+}
+
+// Reconcile creates or updates the Service of the target if its external IPs
+// differ from the public IPs of the eligible nodes. It fails with
+// ErrNotSynced unless the registry has synced.
+func (r *Reconciler) Reconcile(ctx context.Context, t Target) error {
+	if !r.reg.HasSynced() {
+		return ErrNotSynced
+	}
+	ips, err := Publish(ctx, r.client, t, r.reg.Evaluate(t.Eligibility))
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.published[t.Key()] = ips
+	// a sink waiting for its retry gets the latest IPs then
+	if r.sinkQueue != nil && len(r.targets[t.Key()].Sinks) > 0 && r.sinkQueue.NumRequeues(t.Key()) == 0 {
+		r.sinkQueue.Add(t.Key())
+	}
+	return nil
+}
+
+// runSinks publishes the IPs of the targets to their sinks until the queue
+// shuts down. Failed sinks are retried with exponential backoff, forever,
+// since they do not affect the Services.
+func (r *Reconciler) runSinks(ctx context.Context, queue workqueue.TypedRateLimitingInterface[string]) {
+	for {
+		key, shutdown := queue.Get()
+		if shutdown {
+			return
+		}
+		r.mu.Lock()
+		ips := r.published[key]
+		r.mu.Unlock()
+		t := r.targets[key]
+		var errs []error
+		for _, sink := range t.Sinks {
+			if err := sink.Publish(ctx, ips); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		switch err := errors.Join(errs...); {
+		case err == nil, ctx.Err() != nil:
+			queue.Forget(key)
+		default:
+			metrics.SinkFailures.WithLabelValues(key).Inc()
+			slog.Error("error publishing IPs to sinks, will retry", "err", err, "name", t.Name, "namespace", t.Namespace, "retries", queue.NumRequeues(key))
+			queue.AddRateLimited(key)
+		}
+		queue.Done(key)
+	}
+}
+
+// Publish creates or updates the Service of the target if its external IPs
+// differ from the public IPs of the eligible nodes of the evaluations and the
+// static IPs of the target. It returns the published IPs of the Service.
+// A Service of a target with an owner fails with ErrForeignService if it
+// exists, but neither has the owner nor was applied by exips.
+func Publish(ctx context.Context, client kubernetes.Interface, t Target, evaluations []registry.Evaluation) ([]string, error) {
+	observeEvaluations(t.Key(), evaluations)
+	externalIPs := registry.MergeIPs(
+		registry.PublicIPs(evaluations, t.FamilyPolicy, t.AddressTypes),
+		registry.StaticIPs(evaluations, t.FamilyPolicy, t.StaticIPs)...,
+	)
+	externalIPStrings := make([]string, len(externalIPs))
+	for i, ip := range externalIPs {
+		externalIPStrings[i] = ip.String()
+	}
+
+	existingSvc, err := service.Get(ctx, client, t.Name, t.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	var svc *corev1.Service
+	if t.Type == corev1.ServiceTypeLoadBalancer {
+		svc = service.NewLoadBalancer(t.Name, t.FamilyPolicy, t.Ports)
+	} else {
+		svc = service.New(t.Name, externalIPStrings, t.FamilyPolicy, t.Ports)
+	}
+	if t.Owner != nil {
+		svc.OwnerReferences = []metav1.OwnerReference{*t.Owner}
+	}
+	if t.Endpoints != "" {
+		svc.Annotations = map[string]string{service.AnnotationEndpoints: string(t.Endpoints)}
+	}
+	if t.Owner != nil && existingSvc != nil && !ownedBy(existingSvc, t.Owner) && !service.Managed(existingSvc) {
+		return nil, fmt.Errorf("%w: Service %s", ErrForeignService, t.Key())
+	}
+	// before the annotation is removed, so a failure is retried
+	if t.Endpoints == "" && existingSvc != nil && existingSvc.Annotations[service.AnnotationEndpoints] != "" {
+		deleted, err := service.DeleteEndpointSlices(ctx, client, t.Name, t.Namespace)
+		for _, name := range deleted {
+			slog.Info("EndpointSlice deleted", "name", name, "namespace", t.Namespace)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	appliedSvc := existingSvc
+	switch {
+	case existingSvc == nil: // create service
+		if appliedSvc, err = apply(ctx, client, t, svc); err != nil {
+			return nil, err
+		}
+		slog.Info("Service created", "name", t.Name, "namespace", t.Namespace, "type", svc.Spec.Type, "external_ips", svc.Spec.ExternalIPs)
+	case service.UpToDate(existingSvc, svc) && ownedBy(existingSvc, t.Owner):
+		slog.Debug("Service is already up to date", "name", t.Name, "namespace", t.Namespace, "external_ips", existingSvc.Spec.ExternalIPs)
+	default: // service exists, requires update
+		if appliedSvc, err = apply(ctx, client, t, svc); err != nil {
+			return nil, err
+		}
+		slog.Info("Service updated", "name", t.Name, "namespace", t.Namespace, "type", svc.Spec.Type, "external_ips", svc.Spec.ExternalIPs)
+	}
+	if t.Type == corev1.ServiceTypeLoadBalancer {
+		if existingSvc != nil && service.StatusUpToDate(existingSvc, externalIPStrings) {
+			slog.Debug("Service status is already up to date", "name", t.Name, "namespace", t.Namespace, "ips", externalIPStrings)
+		} else {
+			if err := service.ApplyStatus(ctx, client, t.Name, t.Namespace, externalIPStrings); err != nil {
+				return nil, err
+			}
+			slog.Info("Service status updated", "name", t.Name, "namespace", t.Namespace, "ips", externalIPStrings)
+		}
+	}
+	if t.Endpoints != "" {
+		// the applied Service has the UID of a created one and the current ports
+		if err := publishEndpoints(ctx, client, t, appliedSvc, evaluations); err != nil {
+			return nil, err
+		}
+	}
+	metrics.PublishedExternalIPs.WithLabelValues(t.Key()).Set(float64(len(externalIPStrings)))
+	return externalIPStrings, nil
+}
+
+// publishEndpoints lists the eligible nodes in the EndpointSlices of the
+// Service, one per IP family. The slice of a family the policy excludes is
+// kept empty.
+func publishEndpoints(ctx context.Context, client kubernetes.Interface, t Target, svc *corev1.Service, evaluations []registry.Evaluation) error {
+	endpoints := make(map[discoveryv1.AddressType][]discoveryv1.Endpoint)
+	for _, e := range evaluations {
+		if !e.Verdict.Eligible {
+			continue
+		}
+		ips := e.Node.PublicIPsByType(t.AddressTypes)
+		if t.Endpoints == service.EndpointAddressesInternal {
+			ips = e.Node.InternalIPs()
+		}
+		for _, ip := range t.FamilyPolicy.Select(ips) {
+			addressType := discoveryv1.AddressTypeIPv4
+			if ip.Is6() {
+				addressType = discoveryv1.AddressTypeIPv6
+			}
+			endpoints[addressType] = append(endpoints[addressType], service.NodeEndpoint(e.Node, ip))
+		}
+	}
+	for _, addressType := range []discoveryv1.AddressType{discoveryv1.AddressTypeIPv4, discoveryv1.AddressTypeIPv6} {
+		slice := service.NewEndpointSlice(svc, addressType, endpoints[addressType])
+		existing, err := service.GetEndpointSlice(ctx, client, slice.Name, t.Namespace)
+		if err != nil {
+			return err
+		}
+		if existing != nil && service.EndpointSliceUpToDate(existing, slice) {
+			slog.Debug("EndpointSlice is already up to date", "name", slice.Name, "namespace", t.Namespace)
+			continue
+		}
+		if err := service.ApplyEndpointSlice(ctx, client, slice); err != nil {
+			return err
+		}
+		slog.Info("EndpointSlice updated", "name", slice.Name, "namespace", t.Namespace, "endpoints", len(slice.Endpoints))
+	}
+	return nil
+}
+
+// ownedBy returns true if the Service has the owner, or there is no owner.
+func ownedBy(svc *corev1.Service, owner *metav1.OwnerReference) bool {
+	if owner == nil {
+		return true
+	}
+	return slices.ContainsFunc(svc.OwnerReferences, func(ref metav1.OwnerReference) bool {
+		return ref.UID == owner.UID
+	})
+}
+
+// apply applies the Service of the target, records its latency and returns
+// the applied Service.
+func apply(ctx context.Context, client kubernetes.Interface, t Target, svc *corev1.Service) (*corev1.Service, error) {
+	start := time.Now()
+	applied, err := service.Apply(ctx, client, svc, t.Namespace)
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	metrics.ServiceApplyDuration.WithLabelValues(t.Key(), result).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+	metrics.LastSuccessfulApply.WithLabelValues(t.Key()).SetToCurrentTime()
+	return applied, nil
+}
+
+// observeEvaluations records the number of eligible and ineligible nodes.
+func observeEvaluations(key string, evaluations []registry.Evaluation) {
+	eligible := 0
+	ineligible := make(map[string]int)
+	for _, e := range evaluations {
+		if e.Verdict.Eligible {
+			eligible++
+		} else {
+			ineligible[e.Verdict.Reason]++
+		}
+	}
+	metrics.EligibleNodes.WithLabelValues(key).Set(float64(eligible))
+	metrics.IneligibleNodes.DeletePartialMatch(prometheus.Labels{"service": key})
+	for reason, n := range ineligible {
+		metrics.IneligibleNodes.WithLabelValues(key, reason).Set(float64(n))
+	}
+}
@@ -0,0 +1,636 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fabiant7t/exips/internal/metrics"
+	"github.com/fabiant7t/exips/internal/node"
+	"github.com/fabiant7t/exips/internal/node/nodetest"
+	"github.com/fabiant7t/exips/internal/node/registry"
+	"github.com/fabiant7t/exips/internal/service"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func testTarget() Target {
+	return Target{
+		Name:         "exips",
+		Namespace:    "exips",
+		Eligibility:  node.DefaultEligibility(),
+		FamilyPolicy: node.DefaultFamilyPolicy,
+	}
+}
+
+// testConfig has an interval way too long to be the reason for any reconcile.
+func testConfig() Config {
+	return Config{
+		Targets:        []Target{testTarget()},
+		Debounce:       10 * time.Millisecond,
+		Interval:       time.Hour,
+		RetryBaseDelay: time.Millisecond,
+		RetryMaxDelay:  10 * time.Millisecond,
+		MaxRetries:     3,
+	}
+}
+
+// syncedRegistry runs a registry until the context is done and waits for it
+// to sync.
+func syncedRegistry(t *testing.T, ctx context.Context, client kubernetes.Interface) *registry.Registry {
+	t.Helper()
+	reg := registry.New()
+	go reg.Run(ctx, client, 0)
+	if err := reg.WaitForSync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+// newReconciler creates a Reconciler or fails the test.
+func newReconciler(t *testing.T, client kubernetes.Interface, reg *registry.Registry, cfg Config) *Reconciler {
+	t.Helper()
+	rec, err := New(client, reg, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// waitForExternalIPs polls the Service of the test target until it has the
+// wanted external IPs.
+func waitForExternalIPs(t *testing.T, client kubernetes.Interface, want []string) {
+	t.Helper()
+	waitForServiceExternalIPs(t, client, testTarget(), want)
+}
+
+// waitForServiceExternalIPs polls the Service of the target until it has the
+// wanted external IPs.
+func waitForServiceExternalIPs(t *testing.T, client kubernetes.Interface, target Target, want []string) {
+	t.Helper()
+	var got []string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		svc, err := client.CoreV1().Services(target.Namespace).Get(context.Background(), target.Name, metav1.GetOptions{})
+		if err == nil {
+			got = svc.Spec.ExternalIPs
+			if slices.Equal(got, want) {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Got %v, want %v", got, want)
+}
+
+func TestReconcile(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	reg := registry.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := newReconciler(t, client, reg, testConfig())
+	if err := rec.Reconcile(ctx, testTarget()); !errors.Is(err, ErrNotSynced) {
+		t.Errorf("Got %v, want %v", err, ErrNotSynced)
+	}
+
+	go reg.Run(ctx, client, 0)
+	if err := reg.WaitForSync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Reconcile(ctx, testTarget()); err != nil {
+		t.Fatal(err)
+	}
+	waitForExternalIPs(t, client, []string{"1.2.3.4"})
+}
+
+func TestRunIsEventDriven(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	reg := registry.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reg.Run(ctx, client, 0)
+
+	rec := newReconciler(t, client, reg, testConfig())
+	go rec.Run(ctx)
+	waitForExternalIPs(t, client, []string{"1.2.3.4"})
+
+	// node added
+	if _, err := client.CoreV1().Nodes().Create(ctx, nodetest.Ready("w-2", "2.3.4.5"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForExternalIPs(t, client, []string{"1.2.3.4", "2.3.4.5"})
+
+	// service deleted manually
+	if err := client.CoreV1().Services("exips").Delete(ctx, "exips", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForExternalIPs(t, client, []string{"1.2.3.4", "2.3.4.5"})
+}
+
+func TestRunRetriesTransientErrors(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	failures := 2
+	client.PrependReactor("get", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if failures > 0 {
+			failures--
+			return true, nil, apierrors.NewTooManyRequests("slow down", 0)
+		}
+		return false, nil, nil
+	})
+	reg := registry.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reg.Run(ctx, client, 0)
+
+	rec := newReconciler(t, client, reg, testConfig())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- rec.Run(ctx)
+	}()
+	waitForExternalIPs(t, client, []string{"1.2.3.4"})
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Errorf("Got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestRunStopsOnFatalError(t *testing.T) {
+	client := fake.NewClientset()
+	client.PrependReactor("get", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "services"}, "exips", errors.New("RBAC"))
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := newReconciler(t, client, syncedRegistry(t, ctx, client), testConfig())
+	if err := rec.Run(ctx); !apierrors.IsForbidden(err) {
+		t.Errorf("Got %v, want forbidden error", err)
+	}
+}
+
+func TestRunGivesUpAfterMaxRetries(t *testing.T) {
+	client := fake.NewClientset()
+	attempts := 0
+	client.PrependReactor("get", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		attempts++
+		return true, nil, apierrors.NewServiceUnavailable("down")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := testConfig()
+	rec := newReconciler(t, client, syncedRegistry(t, ctx, client), cfg)
+	if err := rec.Run(ctx); !apierrors.IsServiceUnavailable(err) {
+		t.Errorf("Got %v, want service unavailable error", err)
+	}
+	if got, want := attempts, cfg.MaxRetries+1; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+}
+
+func TestRunWaitsForSync(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	rec := newReconciler(t, client, registry.New(), testConfig()) // registry never runs
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := rec.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := client.CoreV1().Services("exips").Get(context.Background(), "exips", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Got %v, want not found error", err)
+	}
+}
+
+func TestReconcileRecordsMetrics(t *testing.T) {
+	cordoned := nodetest.Ready("w-2", "2.3.4.5")
+	cordoned.Spec.Taints = []corev1.Taint{{Key: node.TaintUnschedulable, Effect: corev1.TaintEffectNoSchedule}}
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"), cordoned)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	target := testTarget()
+	target.Name = "metrics"
+	rec := newReconciler(t, client, syncedRegistry(t, ctx, client), Config{Targets: []Target{target}})
+	key := target.Key()
+	queue := workqueue.NewTypedRateLimitingQueue(NewRateLimiter(time.Millisecond, time.Millisecond))
+	defer queue.ShutDown()
+	queue.Add(key)
+	queue.Get()
+	if err := rec.handle(ctx, queue, key); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"published", testutil.ToFloat64(metrics.PublishedExternalIPs.WithLabelValues(key)), 1},
+		{"eligible", testutil.ToFloat64(metrics.EligibleNodes.WithLabelValues(key)), 1},
+		{"cordoned", testutil.ToFloat64(metrics.IneligibleNodes.WithLabelValues(key, node.ReasonCordoned)), 1},
+		{"attempts", testutil.ToFloat64(metrics.ReconcileAttempts.WithLabelValues(key)), 1},
+		{"successes", testutil.ToFloat64(metrics.ReconcileSuccesses.WithLabelValues(key)), 1},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s: Got %v, want %v", tc.name, tc.got, tc.want)
+		}
+	}
+	for name, got := range map[string]float64{
+		"last reconcile": testutil.ToFloat64(metrics.LastSuccessfulReconcile.WithLabelValues(key)),
+		"last apply":     testutil.ToFloat64(metrics.LastSuccessfulApply.WithLabelValues(key)),
+	} {
+		if got <= 0 {
+			t.Errorf("%s: Got %v, want a timestamp", name, got)
+		}
+	}
+
+	// every series of the Service is deleted, including the histogram
+	series := func() int {
+		n := 0
+		for _, c := range []prometheus.Collector{
+			metrics.PublishedExternalIPs, metrics.EligibleNodes, metrics.IneligibleNodes,
+			metrics.ReconcileAttempts, metrics.ReconcileSuccesses, metrics.LastSuccessfulReconcile,
+			metrics.ServiceApplyDuration, metrics.LastSuccessfulApply,
+		} {
+			n += testutil.CollectAndCount(c)
+		}
+		return n
+	}
+	before := series()
+	metrics.DeleteService(key)
+	if got, want := series(), before-8; got != want {
+		t.Errorf("Got %d series, want %d", got, want)
+	}
+}
+
+func TestObserveEvaluationsReplacesSeries(t *testing.T) {
+	key := "exips/observe"
+	evaluate := func(reason string) []registry.Evaluation {
+		return []registry.Evaluation{
+			{Node: node.NewDummyNode("w-1", true, true, true, nil), Verdict: node.Verdict{Eligible: true}},
+			{Node: node.NewDummyNode("w-2", true, true, true, nil), Verdict: node.Verdict{Reason: reason}},
+		}
+	}
+	observeEvaluations(key, evaluate(node.ReasonCordoned))
+	observeEvaluations(key, evaluate(node.ReasonNotReady))
+
+	// the cordoned series is gone, not left at 1
+	if got, want := metrics.IneligibleNodes.DeleteLabelValues(key, node.ReasonCordoned), false; got != want {
+		t.Errorf("Got cordoned series %t, want %t", got, want)
+	}
+	if got, want := testutil.ToFloat64(metrics.IneligibleNodes.WithLabelValues(key, node.ReasonNotReady)), 1.0; got != want {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	if got, want := testutil.ToFloat64(metrics.EligibleNodes.WithLabelValues(key)), 1.0; got != want {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	metrics.DeleteService(key)
+}
+
+func TestNewRejectsDuplicateTargets(t *testing.T) {
+	cfg := testConfig()
+	cfg.Targets = append(cfg.Targets, testTarget())
+	if _, err := New(fake.NewClientset(), registry.New(), cfg); err == nil {
+		t.Error("Got nil, want error")
+	}
+}
+
+func TestRunReconcilesAllTargets(t *testing.T) {
+	edge := nodetest.Ready("w-2", "2.3.4.5")
+	edge.Labels = map[string]string{"edge": "true"}
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"), edge)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	public := testTarget()
+	internal := Target{
+		Name:         "internal",
+		Namespace:    "ingress",
+		Eligibility:  node.All(node.DefaultEligibility(), node.RequireLabels(labels.SelectorFromSet(labels.Set{"edge": "true"}))),
+		FamilyPolicy: node.DefaultFamilyPolicy,
+		Ports:        []corev1.ServicePort{{Name: "https", Port: 443}},
+	}
+	cfg := testConfig()
+	cfg.Targets = []Target{public, internal}
+	rec := newReconciler(t, client, syncedRegistry(t, ctx, client), cfg)
+	if got, want := rec.LastSuccess(), (time.Time{}); got != want {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	go rec.Run(ctx)
+	waitForServiceExternalIPs(t, client, public, []string{"1.2.3.4", "2.3.4.5"})
+	waitForServiceExternalIPs(t, client, internal, []string{"2.3.4.5"})
+
+	svc, err := client.CoreV1().Services("ingress").Get(ctx, "internal", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := svc.Spec.Ports[0].Port, int32(443); got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+}
+
+func TestReconcileMigratesPorts(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := newReconciler(t, client, syncedRegistry(t, ctx, client), testConfig())
+	target := testTarget()
+	if err := rec.Reconcile(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+
+	target.Ports = []corev1.ServicePort{{Name: "http", Port: 80}, {Name: "https", Port: 443}}
+	if err := rec.Reconcile(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	svc, err := client.CoreV1().Services("exips").Get(ctx, "exips", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range svc.Spec.Ports {
+		got = append(got, fmt.Sprintf("%s:%d/%s", p.Name, p.Port, p.Protocol))
+	}
+	if want := []string{"http:80/TCP", "https:443/TCP"}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func TestReconcileLoadBalancer(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := newReconciler(t, client, syncedRegistry(t, ctx, client), testConfig())
+	target := testTarget()
+	if err := rec.Reconcile(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+
+	// switch from external IPs to the load balancer status
+	target.Type = corev1.ServiceTypeLoadBalancer
+	if err := rec.Reconcile(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	svc, err := client.CoreV1().Services("exips").Get(ctx, "exips", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := svc.Spec.Type, corev1.ServiceTypeLoadBalancer; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	if got := svc.Spec.ExternalIPs; len(got) != 0 {
+		t.Errorf("Got %v, want no external IPs", got)
+	}
+	if got, want := service.LoadBalancerIPs(svc), []string{"1.2.3.4"}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+	if got, want := *svc.Status.LoadBalancer.Ingress[0].IPMode, corev1.LoadBalancerIPModeProxy; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+}
+
+func TestReconcileEndpointSlices(t *testing.T) {
+	n := nodetest.Ready("w-1", "1.2.3.4")
+	n.Status.Addresses = append(n.Status.Addresses, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.1"})
+	client := fake.NewClientset(n)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := newReconciler(t, client, syncedRegistry(t, ctx, client), testConfig())
+	target := testTarget()
+	target.Ports = []corev1.ServicePort{{Name: "https", Port: 443, TargetPort: intstr.FromString("websecure")}}
+	for _, tc := range []struct {
+		endpoints service.EndpointAddresses
+		want      string
+	}{
+		{service.EndpointAddressesInternal, "10.0.0.1"},
+		{service.EndpointAddressesPublic, "1.2.3.4"},
+	} {
+		target.Endpoints = tc.endpoints
+		if err := rec.Reconcile(ctx, target); err != nil {
+			t.Fatal(err)
+		}
+		slice, err := client.DiscoveryV1().EndpointSlices("exips").Get(ctx, "exips-exips-ipv4", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := slice.Labels[discoveryv1.LabelServiceName], "exips"; got != want {
+			t.Errorf("Got %s, want %s", got, want)
+		}
+		if got, want := len(slice.Endpoints), 1; got != want {
+			t.Fatalf("Got %d, want %d", got, want)
+		}
+		endpoint := slice.Endpoints[0]
+		if got, want := endpoint.Addresses, []string{tc.want}; !slices.Equal(got, want) {
+			t.Errorf("Got %v, want %v", got, want)
+		}
+		if got, want := *endpoint.NodeName, "w-1"; got != want {
+			t.Errorf("Got %s, want %s", got, want)
+		}
+		if !*endpoint.Conditions.Ready || !*endpoint.Conditions.Serving || *endpoint.Conditions.Terminating {
+			t.Errorf("Got %+v, want ready and serving", endpoint.Conditions)
+		}
+		if got, want := *slice.Ports[0].Port, int32(443); got != want {
+			t.Errorf("Got %d, want %d", got, want)
+		}
+	}
+	slice, err := client.DiscoveryV1().EndpointSlices("exips").Get(ctx, "exips-exips-ipv6", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := slice.Endpoints; len(got) != 0 {
+		t.Errorf("Got %v, want no endpoints", got)
+	}
+
+	// changed ports are the ports of the endpoints right away
+	target.Ports = []corev1.ServicePort{{Name: "https", Port: 8443}}
+	if err := rec.Reconcile(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	slice, err = client.DiscoveryV1().EndpointSlices("exips").Get(ctx, "exips-exips-ipv4", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := *slice.Ports[0].Port, int32(8443); got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+
+	// disabled endpoints delete the EndpointSlices of exips only
+	other := &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{
+		Name:   "exips-other",
+		Labels: map[string]string{discoveryv1.LabelServiceName: "exips", discoveryv1.LabelManagedBy: "example.com/other"},
+	}}
+	if _, err := client.DiscoveryV1().EndpointSlices("exips").Create(ctx, other, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	target.Endpoints = ""
+	if err := rec.Reconcile(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	list, err := client.DiscoveryV1().EndpointSlices("exips").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(list.Items), 1; got != want {
+		t.Fatalf("Got %d, want %d", got, want)
+	}
+	if got, want := list.Items[0].Name, "exips-other"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+
+	// once deleted, the EndpointSlices are not listed again
+	client.ClearActions()
+	if err := rec.Reconcile(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range client.Actions() {
+		if action.GetResource().Resource == "endpointslices" {
+			t.Errorf("Got %s of %s, want no action", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
+
+// sinkFunc adapts a function to a Sink.
+type sinkFunc func(ctx context.Context, ips []string) error
+
+func (f sinkFunc) Publish(ctx context.Context, ips []string) error {
+	return f(ctx, ips)
+}
+
+func TestRunPublishesToSinks(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	published := make(chan []string, 10)
+	cfg := testConfig()
+	cfg.Targets[0].Sinks = []Sink{sinkFunc(func(_ context.Context, ips []string) error {
+		published <- ips
+		return nil
+	})}
+	rec := newReconciler(t, client, syncedRegistry(t, ctx, client), cfg)
+	go rec.Run(ctx)
+	select {
+	case got := <-published:
+		if want := []string{"1.2.3.4"}; !slices.Equal(got, want) {
+			t.Errorf("Got %v, want %v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Got no publish")
+	}
+}
+
+func TestRunRetriesFailingSinks(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	attempts := make(chan struct{}, 100)
+	cfg := testConfig()
+	cfg.Targets[0].Sinks = []Sink{sinkFunc(func(context.Context, []string) error {
+		attempts <- struct{}{}
+		return errors.New("server unreachable")
+	})}
+	rec := newReconciler(t, client, syncedRegistry(t, ctx, client), cfg)
+	before := testutil.ToFloat64(metrics.SinkFailures.WithLabelValues(testTarget().Key()))
+	errc := make(chan error, 1)
+	go func() { errc <- rec.Run(ctx) }()
+
+	// more failures than the reconcile may have, without stopping Run
+	for range cfg.MaxRetries + 2 {
+		select {
+		case <-attempts:
+		case err := <-errc:
+			t.Fatalf("Run stopped: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Got no retry of the sink")
+		}
+	}
+	waitForExternalIPs(t, client, []string{"1.2.3.4"})
+	if got := rec.Targets()[0]; got.LastError != "" {
+		t.Errorf("Got %q, want no error of the Service", got.LastError)
+	}
+	if got := testutil.ToFloat64(metrics.SinkFailures.WithLabelValues(testTarget().Key())) - before; got < 1 {
+		t.Errorf("Got %v sink failures, want at least 1", got)
+	}
+}
+
+func TestReconcilePublishesStaticIPs(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := newReconciler(t, client, syncedRegistry(t, ctx, client), testConfig())
+	staticIPs, err := registry.ParseStaticIPs("1.2.3.4,203.0.113.10,198.51.100.7@keepalived=master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := testTarget()
+	target.StaticIPs = staticIPs
+	if err := rec.Reconcile(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	waitForExternalIPs(t, client, []string{"1.2.3.4", "203.0.113.10"})
+}
+
+func TestPublishRefusesForeignServices(t *testing.T) {
+	client := fake.NewClientset(
+		nodetest.Ready("w-1", "1.2.3.4"),
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "exips", Namespace: "exips"}},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg := syncedRegistry(t, ctx, client)
+	target := testTarget()
+	target.Owner = &metav1.OwnerReference{APIVersion: "exips.io/v1alpha1", Kind: "ExternalIPSet", Name: "exips", UID: "set-uid"}
+	if _, err := Publish(ctx, client, target, reg.Evaluate(target.Eligibility)); !errors.Is(err, ErrForeignService) {
+		t.Errorf("Got %v, want %v", err, ErrForeignService)
+	}
+	svc, err := client.CoreV1().Services("exips").Get(ctx, "exips", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := svc.Spec.ExternalIPs; len(got) != 0 {
+		t.Errorf("Got %v, want no external IPs", got)
+	}
+
+	// Services applied by exips are taken over, e.g. of a former target
+	if _, err := service.Apply(ctx, client, service.New("exips", nil, target.FamilyPolicy, nil), "exips"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Publish(ctx, client, target, reg.Evaluate(target.Eligibility)); err != nil {
+		t.Fatal(err)
+	}
+	waitForExternalIPs(t, client, []string{"1.2.3.4"})
+}
+
+func TestTargets(t *testing.T) {
+	client := fake.NewClientset(nodetest.Ready("w-1", "1.2.3.4"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := newReconciler(t, client, syncedRegistry(t, ctx, client), testConfig())
+	if got := rec.Targets()[0]; got.LastSuccess != nil || got.PublishedIPs != nil {
+		t.Errorf("Got %+v, want no state before the first reconcile", got)
+	}
+	go rec.Run(ctx)
+	waitForExternalIPs(t, client, []string{"1.2.3.4"})
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := rec.Targets()[0]; got.LastSuccess != nil {
+			if want := []string{"1.2.3.4"}; !slices.Equal(got.PublishedIPs, want) {
+				t.Errorf("Got %v, want %v", got.PublishedIPs, want)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Got no last success")
+}
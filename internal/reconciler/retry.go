@@ -0,0 +1,91 @@
+package reconciler
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// IsRetryable returns false for errors that will not go away by retrying,
+// like missing permissions or a Service the API server refuses to accept.
+// Everything else, e.g. timeouts, throttling, conflicts, server and network
+// errors, is considered transient.
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil, errors.Is(err, ErrForeignService):
+		return false
+	case apierrors.IsUnauthorized(err),
+		apierrors.IsForbidden(err),
+		apierrors.IsInvalid(err),
+		apierrors.IsBadRequest(err),
+		apierrors.IsNotFound(err), // the namespace does not exist
+		apierrors.IsMethodNotSupported(err),
+		apierrors.IsNotAcceptable(err),
+		apierrors.IsUnsupportedMediaType(err),
+		apierrors.IsRequestEntityTooLargeError(err):
+		return false
+	}
+	return true
+}
+
+// backoff is a workqueue rate limiter with exponential backoff and jitter per
+// item. The delay doubles with every failure, starting at baseDelay and
+// capped at maxDelay, plus up to jitterFactor times the delay.
+type backoff struct {
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	jitterFactor float64
+
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+// NewRateLimiter returns the backoff of the Reconciler for the workqueues of
+// other controllers, so they retry with the same delays.
+func NewRateLimiter(baseDelay, maxDelay time.Duration) workqueue.TypedRateLimiter[string] {
+	return newBackoff(baseDelay, maxDelay, retryJitterFactor)
+}
+
+func newBackoff(baseDelay, maxDelay time.Duration, jitterFactor float64) *backoff {
+	return &backoff{
+		baseDelay:    baseDelay,
+		maxDelay:     maxDelay,
+		jitterFactor: jitterFactor,
+		failures:     make(map[string]int),
+	}
+}
+
+// When returns the delay before retrying the item and counts a failure.
+func (b *backoff) When(item string) time.Duration {
+	b.mu.Lock()
+	exp := b.failures[item]
+	b.failures[item]++
+	b.mu.Unlock()
+
+	delay := float64(b.baseDelay) * math.Pow(2, float64(exp))
+	if delay > float64(b.maxDelay) {
+		delay = float64(b.maxDelay)
+	}
+	return wait.Jitter(time.Duration(delay), b.jitterFactor)
+}
+
+// NumRequeues returns the number of consecutive failures of the item.
+func (b *backoff) NumRequeues(item string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.failures[item]
+}
+
+// Forget resets the failures of the item.
+func (b *backoff) Forget(item string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.failures, item)
+}
@@ -0,0 +1,60 @@
+package reconciler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestIsRetryable(t *testing.T) {
+	gr := schema.GroupResource{Resource: "services"}
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "too many requests", err: apierrors.NewTooManyRequests("slow down", 1), want: true},
+		{name: "timeout", err: apierrors.NewTimeoutError("timeout", 1), want: true},
+		{name: "server timeout", err: apierrors.NewServerTimeout(gr, "patch", 1), want: true},
+		{name: "internal error", err: apierrors.NewInternalError(errors.New("boom")), want: true},
+		{name: "service unavailable", err: apierrors.NewServiceUnavailable("down"), want: true},
+		{name: "conflict", err: apierrors.NewConflict(gr, "exips", errors.New("conflict")), want: true},
+		{name: "network error", err: errors.New("connection refused"), want: true},
+		{name: "forbidden", err: apierrors.NewForbidden(gr, "exips", errors.New("RBAC")), want: false},
+		{name: "unauthorized", err: apierrors.NewUnauthorized("token expired"), want: false},
+		{name: "invalid", err: apierrors.NewInvalid(schema.GroupKind{Kind: "Service"}, "exips", nil), want: false},
+		{name: "bad request", err: apierrors.NewBadRequest("bad"), want: false},
+		{name: "namespace not found", err: apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, "exips"), want: false},
+	} {
+		if got, want := IsRetryable(tc.err), tc.want; got != want {
+			t.Errorf("%s: Got %t, want %t", tc.name, got, want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(100*time.Millisecond, time.Second, 0.2)
+	for _, want := range []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second, // capped
+		time.Second,
+	} {
+		got := b.When("exips/exips")
+		if got < want || got > want+want/5 {
+			t.Errorf("Got %s, want %s plus up to 20%% jitter", got, want)
+		}
+	}
+	if got, want := b.NumRequeues("exips/exips"), 6; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+	b.Forget("exips/exips")
+	if got, want := b.NumRequeues("exips/exips"), 0; got != want {
+		t.Errorf("Got %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/fabiant7t/exips/internal/node"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+// EndpointSliceManager is the managed-by label of the EndpointSlices of
+// exips, so the EndpointSlice controller leaves them alone. Unlike the load
+// balancer class, it is a label value and cannot contain a slash.
+const EndpointSliceManager = "exips.io"
+
+// EndpointAddresses decides which node addresses are the endpoints of the
+// Service.
+type EndpointAddresses string
+
+const (
+	// EndpointAddressesInternal lists the internal IPs of the nodes, private
+	// or not.
+	EndpointAddressesInternal EndpointAddresses = "Internal"
+	// EndpointAddressesPublic lists the public IPs of the nodes, the same IPs
+	// the Service publishes.
+	EndpointAddressesPublic EndpointAddresses = "Public"
+)
+
+// ParseEndpointAddresses parses Internal or Public, case insensitive.
+func ParseEndpointAddresses(s string) (EndpointAddresses, error) {
+	for _, a := range []EndpointAddresses{EndpointAddressesInternal, EndpointAddressesPublic} {
+		if strings.EqualFold(s, string(a)) {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("invalid endpoint addresses %q, want Internal or Public", s)
+}
+
+// EndpointSliceName returns the name of the EndpointSlice of the Service for
+// the address type.
+func EndpointSliceName(serviceName string, addressType discoveryv1.AddressType) string {
+	return serviceName + "-exips-" + strings.ToLower(string(addressType))
+}
+
+// NodeEndpoint returns the endpoint of the node at the IP. A cordoned node is
+// terminating and therefore not ready, but still serving if it is ready.
+func NodeEndpoint(n node.Node, ip netip.Addr) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses: []string{ip.String()},
+		Conditions: discoveryv1.EndpointConditions{
+			Ready:       ptr.To(n.IsReady() && n.IsSchedulable()),
+			Serving:     ptr.To(n.IsReady()),
+			Terminating: ptr.To(!n.IsSchedulable()),
+		},
+		NodeName: ptr.To(n.Name()),
+	}
+}
+
+// NewEndpointSlice returns the EndpointSlice of the Service listing the
+// endpoints of one address type. Its ports are the target ports of the
+// Service, or the ports if the target port is a name, since there are no Pods
+// to resolve it.
+func NewEndpointSlice(svc *corev1.Service, addressType discoveryv1.AddressType, endpoints []discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	ports := make([]discoveryv1.EndpointPort, len(svc.Spec.Ports))
+	for i, p := range withPortDefaults(svc.Spec.Ports) {
+		port := p.TargetPort.IntVal
+		if port == 0 {
+			port = p.Port
+		}
+		ports[i] = discoveryv1.EndpointPort{
+			Name:        ptr.To(p.Name),
+			Port:        ptr.To(port),
+			Protocol:    ptr.To(p.Protocol),
+			AppProtocol: p.AppProtocol,
+		}
+	}
+	slice := &discoveryv1.EndpointSlice{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "discovery.k8s.io/v1",
+			Kind:       "EndpointSlice",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      EndpointSliceName(svc.Name, addressType),
+			Namespace: svc.Namespace,
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: svc.Name,
+				discoveryv1.LabelManagedBy:   EndpointSliceManager,
+			},
+		},
+		AddressType: addressType,
+		Endpoints:   endpoints,
+		Ports:       ports,
+	}
+	if svc.UID != "" {
+		slice.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "v1",
+			Kind:       "Service",
+			Name:       svc.Name,
+			UID:        svc.UID,
+		}}
+	}
+	return slice
+}
+
+// EndpointSliceUpToDate returns true if the existing EndpointSlice has the
+// labels, owner, endpoints and ports of the desired EndpointSlice.
+func EndpointSliceUpToDate(existing, desired *discoveryv1.EndpointSlice) bool {
+	for k, v := range desired.Labels {
+		if existing.Labels[k] != v {
+			return false
+		}
+	}
+	return existing.AddressType == desired.AddressType &&
+		equality.Semantic.DeepEqual(existing.OwnerReferences, desired.OwnerReferences) &&
+		equality.Semantic.DeepEqual(existing.Endpoints, desired.Endpoints) &&
+		equality.Semantic.DeepEqual(existing.Ports, desired.Ports)
+}
+
+// GetEndpointSlice fetches the EndpointSlice by name and namespace.
+// Returns nil and no error if the EndpointSlice does not exist.
+func GetEndpointSlice(ctx context.Context, client kubernetes.Interface, name, namespace string) (*discoveryv1.EndpointSlice, error) {
+	slice, err := client.DiscoveryV1().EndpointSlices(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return slice, nil
+}
+
+// ApplyEndpointSlice creates or updates the EndpointSlice.
+func ApplyEndpointSlice(ctx context.Context, client kubernetes.Interface, slice *discoveryv1.EndpointSlice) error {
+	data, err := json.Marshal(slice)
+	if err != nil {
+		return fmt.Errorf("error marshaling endpoint slice to JSON: %w ", err)
+	}
+
+	yes := true
+	_, err = client.DiscoveryV1().EndpointSlices(slice.Namespace).Patch(
+		ctx,
+		slice.Name,
+		types.ApplyPatchType,
+		data,
+		metav1.PatchOptions{
+			FieldManager: "exips-endpointslice",
+			Force:        &yes,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error patching endpoint slice: %w ", err)
+	}
+	return nil
+}
+
+// DeleteEndpointSlices deletes the EndpointSlices exips manages for the
+// Service, e.g. once its endpoints are disabled, and returns their names.
+func DeleteEndpointSlices(ctx context.Context, client kubernetes.Interface, serviceName, namespace string) ([]string, error) {
+	selector := labels.SelectorFromSet(labels.Set{
+		discoveryv1.LabelServiceName: serviceName,
+		discoveryv1.LabelManagedBy:   EndpointSliceManager,
+	})
+	slices, err := client.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("error listing endpoint slices: %w ", err)
+	}
+	var deleted []string
+	for _, slice := range slices.Items {
+		err := client.DiscoveryV1().EndpointSlices(namespace).Delete(ctx, slice.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return deleted, fmt.Errorf("error deleting endpoint slice: %w ", err)
+		}
+		deleted = append(deleted, slice.Name)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/fabiant7t/exips/internal/node"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+// LoadBalancerClass of the LoadBalancer Services exips provides the status
+// for. Load balancer implementations of the cloud provider ignore them.
+const LoadBalancerClass = "exips.io/exips"
+
+// NewLoadBalancer returns a LoadBalancer Service whose status is provided by
+// exips rather than a load balancer implementation. Like the Service of New,
+// it has no selector. No node ports are allocated, since the IPs are the
+// ingress controller's host ports.
+func NewLoadBalancer(name string, policy node.FamilyPolicy, ports []corev1.ServicePort) *corev1.Service {
+	svc := New(name, nil, policy, ports)
+	svc.Spec.Type = corev1.ServiceTypeLoadBalancer
+	svc.Spec.LoadBalancerClass = ptr.To(LoadBalancerClass)
+	svc.Spec.AllocateLoadBalancerNodePorts = ptr.To(false)
+	return svc
+}
+
+// LoadBalancerIngress returns the status of a LoadBalancer Service publishing
+// the IPs. The IP mode is Proxy, so kube-proxy does not capture the traffic to
+// the IPs, which the Service without endpoints would reject.
+func LoadBalancerIngress(ips []string) []corev1.LoadBalancerIngress {
+	ingress := make([]corev1.LoadBalancerIngress, len(ips))
+	for i, ip := range ips {
+		ingress[i] = corev1.LoadBalancerIngress{
+			IP:     ip,
+			IPMode: ptr.To(corev1.LoadBalancerIPModeProxy),
+		}
+	}
+	return ingress
+}
+
+// LoadBalancerIPs returns the IPs of the load balancer status of the Service.
+func LoadBalancerIPs(svc *corev1.Service) []string {
+	var ips []string
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			ips = append(ips, ingress.IP)
+		}
+	}
+	return ips
+}
+
+// StatusUpToDate returns true if the load balancer status of the existing
+// Service publishes exactly the IPs. A missing IP mode is up to date, since
+// API servers without the LoadBalancerIPMode feature drop it.
+func StatusUpToDate(existing *corev1.Service, ips []string) bool {
+	return slices.EqualFunc(existing.Status.LoadBalancer.Ingress, LoadBalancerIngress(ips), func(e, d corev1.LoadBalancerIngress) bool {
+		return e.IP == d.IP && e.Hostname == "" && (e.IPMode == nil || *e.IPMode == ptr.Deref(d.IPMode, ""))
+	})
+}
+
+// ApplyStatus sets the load balancer status of the Service to the IPs. It
+// uses a field manager of its own, so it never removes fields of the spec.
+func ApplyStatus(ctx context.Context, client kubernetes.Interface, name, namespace string, ips []string) error {
+	svc := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: LoadBalancerIngress(ips),
+			},
+		},
+	}
+	data, err := json.Marshal(svc)
+	if err != nil {
+		return fmt.Errorf("error marshaling service status to JSON: %w ", err)
+	}
+
+	yes := true
+	_, err = client.CoreV1().Services(namespace).Patch(
+		ctx,
+		name,
+		types.ApplyPatchType,
+		data,
+		metav1.PatchOptions{
+			FieldManager: "exips-service-status",
+			Force:        &yes,
+		},
+		"status",
+	)
+	if err != nil {
+		return fmt.Errorf("error patching service status: %w ", err)
+	}
+	return nil
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
+
+	"github.com/fabiant7t/exips/internal/node"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -11,12 +14,32 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
 )
 
+// DefaultPorts are the ports of a Service without configured ports. A Service
+// requires at least one port, but nothing listens on it.
+func DefaultPorts() []corev1.ServicePort {
+	return []corev1.ServicePort{
+		{
+			Name:       "dummy",
+			Port:       6942,
+			TargetPort: intstr.FromInt(6942),
+		},
+	}
+}
+
 // New returns a Service that acts as a sidekick to the ingress controller,
 // exposing the cluster’s external IPs. The Service is intentionally created
 // without a selector so it is not backed by any Pods.
-func New(name string, externalIPs []string) *corev1.Service {
+// Its IP families follow the family policy used to select the external IPs.
+// The DefaultPorts are used if no ports are given.
+func New(name string, externalIPs []string, policy node.FamilyPolicy, ports []corev1.ServicePort) *corev1.Service {
+	if len(ports) == 0 {
+		ports = DefaultPorts()
+	}
+	ports = withPortDefaults(ports)
+	ipFamilies, ipFamilyPolicy := IPFamilies(policy)
 	return &corev1.Service{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
@@ -26,41 +49,118 @@ func New(name string, externalIPs []string) *corev1.Service {
 			Name: name,
 		},
 		Spec: corev1.ServiceSpec{
-			Type: corev1.ServiceTypeClusterIP,
-			Ports: []corev1.ServicePort{
-				{
-					Name:       "dummy",
-					Port:       6942,
-					TargetPort: intstr.FromInt(6942),
-				},
-			},
-			ExternalIPs: externalIPs,
+			Type:           corev1.ServiceTypeClusterIP,
+			Ports:          ports,
+			ExternalIPs:    externalIPs,
+			IPFamilies:     ipFamilies,
+			IPFamilyPolicy: &ipFamilyPolicy,
 		},
 	}
 }
 
-// Apply creates or updates the given service in the given namespace.
-func Apply(ctx context.Context, client kubernetes.Interface, svc *corev1.Service, namespace string) error {
+// IPFamilies maps the family policy to the IP families and IP family policy
+// of the Service. Policies that may publish both families prefer dual-stack
+// and leave the families to the cluster, so they work on single-stack
+// clusters of either family.
+func IPFamilies(policy node.FamilyPolicy) ([]corev1.IPFamily, corev1.IPFamilyPolicy) {
+	switch policy {
+	case node.FamilyPolicyIPv4Only:
+		return []corev1.IPFamily{corev1.IPv4Protocol}, corev1.IPFamilyPolicySingleStack
+	case node.FamilyPolicyIPv6Only:
+		return []corev1.IPFamily{corev1.IPv6Protocol}, corev1.IPFamilyPolicySingleStack
+	default:
+		return nil, corev1.IPFamilyPolicyPreferDualStack
+	}
+}
+
+// withPortDefaults returns a copy of the ports with the protocol and target
+// port the API server would default, so they compare equal to existing ports.
+func withPortDefaults(ports []corev1.ServicePort) []corev1.ServicePort {
+	ports = slices.Clone(ports)
+	for i := range ports {
+		if ports[i].Protocol == "" {
+			ports[i].Protocol = corev1.ProtocolTCP
+		}
+		if ports[i].TargetPort.IntVal == 0 && ports[i].TargetPort.StrVal == "" {
+			ports[i].TargetPort = intstr.FromInt32(ports[i].Port)
+		}
+	}
+	return ports
+}
+
+// equalPorts compares the configurable fields of two ports.
+func equalPorts(a, b corev1.ServicePort) bool {
+	return a.Name == b.Name &&
+		a.Port == b.Port &&
+		a.Protocol == b.Protocol &&
+		a.TargetPort == b.TargetPort &&
+		ptr.Deref(a.AppProtocol, "") == ptr.Deref(b.AppProtocol, "")
+}
+
+// AnnotationEndpoints marks the Services whose EndpointSlices exips manages,
+// with the node addresses they list, so they are deleted once the endpoints
+// are disabled.
+const AnnotationEndpoints = "exips.io/endpoints"
+
+// UpToDate returns true if the existing Service has the type, endpoints
+// annotation and publishes the external IPs, ports and IP families of the
+// desired Service.
+func UpToDate(existing, desired *corev1.Service) bool {
+	if existing.Annotations[AnnotationEndpoints] != desired.Annotations[AnnotationEndpoints] {
+		return false
+	}
+	if existing.Spec.Type != desired.Spec.Type || ptr.Deref(existing.Spec.LoadBalancerClass, "") != ptr.Deref(desired.Spec.LoadBalancerClass, "") {
+		return false
+	}
+	if !slices.Equal(existing.Spec.ExternalIPs, desired.Spec.ExternalIPs) {
+		return false
+	}
+	if !slices.EqualFunc(existing.Spec.Ports, withPortDefaults(desired.Spec.Ports), equalPorts) {
+		return false
+	}
+	if existing.Spec.IPFamilyPolicy == nil || desired.Spec.IPFamilyPolicy == nil {
+		return existing.Spec.IPFamilyPolicy == desired.Spec.IPFamilyPolicy
+	}
+	if *existing.Spec.IPFamilyPolicy != *desired.Spec.IPFamilyPolicy {
+		return false
+	}
+	// families left to the cluster are filled in by the API server
+	return desired.Spec.IPFamilies == nil || slices.Equal(existing.Spec.IPFamilies, desired.Spec.IPFamilies)
+}
+
+// fieldManager applies the Services of exips.
+const fieldManager = "exips-service"
+
+// Managed returns true if exips applied the Service.
+func Managed(svc *corev1.Service) bool {
+	return slices.ContainsFunc(svc.ManagedFields, func(f metav1.ManagedFieldsEntry) bool {
+		return f.Manager == fieldManager
+	})
+}
+
+// Apply creates or updates the given service in the given namespace and
+// returns the applied Service.
+func Apply(ctx context.Context, client kubernetes.Interface, svc *corev1.Service, namespace string) (*corev1.Service, error) {
 	data, err := json.Marshal(svc)
 	if err != nil {
-		return fmt.Errorf("error marshaling service to JSON: %w ", err)
+		return nil, fmt.Errorf("error marshaling service to JSON: %w ", err)
 	}
 
 	yes := true
-	_, err = client.CoreV1().Services(namespace).Patch(
+	applied, err := client.CoreV1().Services(namespace).Patch(
 		ctx,
 		svc.Name,
 		types.ApplyPatchType,
 		data,
 		metav1.PatchOptions{
-			FieldManager: "exips-service",
+			FieldManager: fieldManager,
 			Force:        &yes,
 		},
 	)
 	if err != nil {
-		return fmt.Errorf("error patching service: %w ", err)
+		return nil, fmt.Errorf("error patching service: %w ", err)
 	}
-	return nil
+	return applied, nil
 }
 
 // Get fetches the Service by name and namespace.
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/fabiant7t/exips/internal/node"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestNewIPFamilies(t *testing.T) {
+	for _, tc := range []struct {
+		policy             node.FamilyPolicy
+		wantIPFamilies     []corev1.IPFamily
+		wantIPFamilyPolicy corev1.IPFamilyPolicy
+	}{
+		{policy: node.FamilyPolicyIPv4Only, wantIPFamilies: []corev1.IPFamily{corev1.IPv4Protocol}, wantIPFamilyPolicy: corev1.IPFamilyPolicySingleStack},
+		{policy: node.FamilyPolicyIPv6Only, wantIPFamilies: []corev1.IPFamily{corev1.IPv6Protocol}, wantIPFamilyPolicy: corev1.IPFamilyPolicySingleStack},
+		{policy: node.FamilyPolicyDualStack, wantIPFamilyPolicy: corev1.IPFamilyPolicyPreferDualStack},
+		{policy: node.FamilyPolicyPreferIPv4, wantIPFamilyPolicy: corev1.IPFamilyPolicyPreferDualStack},
+		{policy: node.FamilyPolicyPreferIPv6, wantIPFamilyPolicy: corev1.IPFamilyPolicyPreferDualStack},
+	} {
+		svc := New("exips", []string{"1.2.3.4"}, tc.policy, nil)
+		if got, want := svc.Spec.IPFamilies, tc.wantIPFamilies; !slices.Equal(got, want) {
+			t.Errorf("%s: Got %v, want %v", tc.policy, got, want)
+		}
+		if got, want := *svc.Spec.IPFamilyPolicy, tc.wantIPFamilyPolicy; got != want {
+			t.Errorf("%s: Got %s, want %s", tc.policy, got, want)
+		}
+	}
+}
+
+func TestUpToDate(t *testing.T) {
+	desired := New("exips", []string{"1.2.3.4", "2001:db8::1"}, node.FamilyPolicyDualStack, nil)
+
+	existing := New("exips", []string{"1.2.3.4", "2001:db8::1"}, node.FamilyPolicyDualStack, nil)
+	existing.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol} // set by API server
+	if got, want := UpToDate(existing, desired), true; got != want {
+		t.Errorf("Got %t, want %t", got, want)
+	}
+
+	existing = New("exips", []string{"1.2.3.4"}, node.FamilyPolicyDualStack, nil)
+	if got, want := UpToDate(existing, desired), false; got != want {
+		t.Errorf("Got %t, want %t", got, want)
+	}
+
+	existing = New("exips", []string{"1.2.3.4", "2001:db8::1"}, node.FamilyPolicyIPv4Only, nil)
+	if got, want := UpToDate(existing, desired), false; got != want {
+		t.Errorf("Got %t, want %t", got, want)
+	}
+
+	existing = New("exips", []string{"1.2.3.4", "2001:db8::1"}, node.FamilyPolicyDualStack, nil)
+	existing.Spec.IPFamilyPolicy = nil // created by an older release
+	if got, want := UpToDate(existing, desired), false; got != want {
+		t.Errorf("Got %t, want %t", got, want)
+	}
+
+	existing = New("exips", []string{"1.2.3.4", "2001:db8::1"}, node.FamilyPolicyDualStack, []corev1.ServicePort{{Name: "http", Port: 80}})
+	if got, want := UpToDate(existing, desired), false; got != want {
+		t.Errorf("Got %t, want %t", got, want)
+	}
+
+	existing = New("exips", []string{"1.2.3.4", "2001:db8::1"}, node.FamilyPolicyDualStack, nil)
+	existing.Annotations = map[string]string{AnnotationEndpoints: string(EndpointAddressesInternal)} // endpoints disabled since
+	if got, want := UpToDate(existing, desired), false; got != want {
+		t.Errorf("Got %t, want %t", got, want)
+	}
+}
+
+func TestUpToDatePorts(t *testing.T) {
+	h2c := "kubernetes.io/h2c"
+	desired := New("exips", []string{"1.2.3.4"}, node.FamilyPolicyIPv4Only, []corev1.ServicePort{{Name: "http", Port: 80}})
+	for _, tc := range []struct {
+		name string
+		port corev1.ServicePort
+		want bool
+	}{
+		{"defaulted by API server", corev1.ServicePort{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromInt32(80)}, true},
+		{"other target port", corev1.ServicePort{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromInt32(8080)}, false},
+		{"other protocol", corev1.ServicePort{Name: "http", Port: 80, Protocol: corev1.ProtocolUDP, TargetPort: intstr.FromInt32(80)}, false},
+		{"app protocol", corev1.ServicePort{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromInt32(80), AppProtocol: &h2c}, false},
+	} {
+		existing := New("exips", []string{"1.2.3.4"}, node.FamilyPolicyIPv4Only, nil)
+		existing.Spec.Ports = []corev1.ServicePort{tc.port}
+		if got := UpToDate(existing, desired); got != tc.want {
+			t.Errorf("%s: Got %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStatusUpToDate(t *testing.T) {
+	vip := corev1.LoadBalancerIPModeVIP
+	for _, tc := range []struct {
+		name    string
+		ingress []corev1.LoadBalancerIngress
+		want    bool
+	}{
+		{"same IPs", LoadBalancerIngress([]string{"1.2.3.4"}), true},
+		{"IP mode dropped by API server", []corev1.LoadBalancerIngress{{IP: "1.2.3.4"}}, true},
+		{"other IP mode", []corev1.LoadBalancerIngress{{IP: "1.2.3.4", IPMode: &vip}}, false},
+		{"other IPs", LoadBalancerIngress([]string{"2.3.4.5"}), false},
+		{"hostname", []corev1.LoadBalancerIngress{{IP: "1.2.3.4", Hostname: "lb.example.com"}}, false},
+		{"no IPs", nil, false},
+	} {
+		existing := NewLoadBalancer("exips", node.FamilyPolicyIPv4Only, nil)
+		existing.Status.LoadBalancer.Ingress = tc.ingress
+		if got := StatusUpToDate(existing, []string{"1.2.3.4"}); got != tc.want {
+			t.Errorf("%s: Got %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEndpointSliceManagerIsLabelValue(t *testing.T) {
+	if errs := validation.IsValidLabelValue(EndpointSliceManager); len(errs) != 0 {
+		t.Errorf("Got %v, want a valid label value", errs)
+	}
+}